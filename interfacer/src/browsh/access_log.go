@@ -0,0 +1,81 @@
+package browsh
+
+import (
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/spf13/viper"
+	"gopkg.in/natefinch/lumberjack.v2"
+)
+
+// Where access log lines are written, nil when the access log is turned off
+var accessLog io.Writer
+
+// One line of the access log. Every field is always present, so that log tooling
+// doesn't need to special case requests that were refused or never rendered.
+type accessLogEntry struct {
+	Time             string `json:"time"`
+	ClientIP         string `json:"client_ip"`
+	Method           string `json:"method"`
+	Path             string `json:"path"`
+	URL              string `json:"url"`
+	Mode             string `json:"mode"`
+	Status           int    `json:"status"`
+	Bytes            int    `json:"bytes"`
+	DurationTotal    int    `json:"duration_total"`
+	DurationPageload int    `json:"duration_page_load"`
+	DurationParsing  int    `json:"duration_parsing"`
+	Cache            string `json:"cache"`
+	Rejection        string `json:"rejection"`
+}
+
+// The access log is rotated once it reaches "access-log-max-size" megabytes
+func setupAccessLog() {
+	path := viper.GetString("http-server.access-log")
+	if path == "" {
+		return
+	}
+	accessLog = &lumberjack.Logger{
+		Filename:   path,
+		MaxSize:    viper.GetInt("http-server.access-log-max-size"),
+		MaxBackups: viper.GetInt("http-server.access-log-max-backups"),
+		MaxAge:     viper.GetInt("http-server.access-log-max-age"),
+	}
+	slog.Info("Writing access log", "path", path)
+}
+
+func newAccessLogEntry(r *http.Request, start time.Time, info *requestInfo) accessLogEntry {
+	return accessLogEntry{
+		Time:             start.UTC().Format(time.RFC3339Nano),
+		ClientIP:         getClientIP(r),
+		Method:           r.Method,
+		Path:             r.RequestURI,
+		URL:              info.url,
+		Mode:             info.mode,
+		Status:           info.status,
+		Bytes:            info.bytes,
+		DurationTotal:    info.totalDuration,
+		DurationPageload: info.pageloadDuration,
+		DurationParsing:  info.parsingDuration,
+		Cache:            info.cache,
+		Rejection:        info.rejection,
+	}
+}
+
+func writeAccessLog(r *http.Request, start time.Time, info *requestInfo) {
+	if accessLog == nil {
+		return
+	}
+	line, err := json.Marshal(newAccessLogEntry(r, start, info))
+	if err != nil {
+		slog.Error("Couldn't encode access log entry", "error", err)
+		return
+	}
+	// A single write per line, so that lines from concurrent requests don't interleave
+	if _, err := accessLog.Write(append(line, '\n')); err != nil {
+		slog.Error("Couldn't write to the access log", "error", err)
+	}
+}
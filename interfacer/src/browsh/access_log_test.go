@@ -0,0 +1,78 @@
+package browsh
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+func TestAccessLog(t *testing.T) {
+	RegisterFailHandler(Fail)
+}
+
+var _ = Describe("Access log", func() {
+	var log *bytes.Buffer
+
+	serve := func(handler http.HandlerFunc) accessLogEntry {
+		var entry accessLogEntry
+		request := httptest.NewRequest("GET", "/https://www.brow.sh", nil)
+		request.Header.Set("X-Forwarded-For", "203.0.113.7, 10.0.0.1")
+		instrument(handler).ServeHTTP(httptest.NewRecorder(), request)
+		Expect(json.Unmarshal(log.Bytes(), &entry)).To(Succeed())
+		return entry
+	}
+
+	BeforeEach(func() {
+		log = &bytes.Buffer{}
+		accessLog = log
+	})
+
+	AfterEach(func() {
+		accessLog = nil
+		renderCache = nil
+	})
+
+	It("should log a line for each request", func() {
+		entry := serve(func(w http.ResponseWriter, r *http.Request) {
+			setRequestTarget(r, "https://www.brow.sh", "PLAIN")
+			w.Write([]byte("rendered"))
+		})
+		Expect(entry.ClientIP).To(Equal("203.0.113.7"))
+		Expect(entry.Method).To(Equal("GET"))
+		Expect(entry.Path).To(Equal("/https://www.brow.sh"))
+		Expect(entry.URL).To(Equal("https://www.brow.sh"))
+		Expect(entry.Mode).To(Equal("PLAIN"))
+		Expect(entry.Status).To(Equal(http.StatusOK))
+		Expect(entry.Bytes).To(Equal(8))
+		Expect(entry.Time).ToNot(BeEmpty())
+		Expect(log.String()).To(HaveSuffix("}\n"))
+	})
+
+	It("should log a render's timings and whether it was cached", func() {
+		renderCache = newMemoryRenderStore(time.Minute, 1024)
+		entry := serve(func(w http.ResponseWriter, r *http.Request) {
+			render := newCachedRender("https://www.brow.sh", "PLAIN",
+				`{"page_load_duration": 300, "parsing_duration": 40}`, 500)
+			setRequestRender(r, render, true)
+		})
+		Expect(entry.DurationTotal).To(Equal(500))
+		Expect(entry.DurationPageload).To(Equal(300))
+		Expect(entry.DurationParsing).To(Equal(40))
+		Expect(entry.Cache).To(Equal("HIT"))
+	})
+
+	It("should log why a request was refused", func() {
+		entry := serve(func(w http.ResponseWriter, r *http.Request) {
+			blockRequest(r, blockedDestination)
+			http.Error(w, "Forbidden", http.StatusForbidden)
+		})
+		Expect(entry.Status).To(Equal(http.StatusForbidden))
+		Expect(entry.Rejection).To(Equal("destination"))
+	})
+})
@@ -0,0 +1,218 @@
+package browsh
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/go-errors/errors"
+)
+
+const (
+	apiPrefix     = "/api/"
+	apiRenderPath = "/api/v1/render"
+	// Routes under here need an admin API key
+	apiAdminPrefix = "/api/v1/admin/"
+	apiPurgePath   = apiAdminPrefix + "cache/purge"
+)
+
+// The body of a POST to the render API. Everything apart from the URL is optional and
+// falls back to the `[http-server]` config.
+type apiRenderRequest struct {
+	URL  string `json:"url"`
+	Mode string `json:"mode"`
+	rawTextOptions
+}
+
+type apiRenderTimings struct {
+	Total    int `json:"total"`
+	Pageload int `json:"page_load"`
+	Parsing  int `json:"parsing"`
+}
+
+type apiRenderResponse struct {
+	Text     string           `json:"text"`
+	Title    string           `json:"title"`
+	URL      string           `json:"url"`
+	FinalURL string           `json:"final_url"`
+	Mode     string           `json:"mode"`
+	Links    []rawTextLink    `json:"links"`
+	Timings  apiRenderTimings `json:"timings"`
+}
+
+// The body of a POST to the purge API. An empty URL purges the whole cache.
+type apiPurgeRequest struct {
+	URL string `json:"url"`
+}
+
+type apiPurgeResponse struct {
+	Purged int `json:"purged"`
+}
+
+type apiError struct {
+	Error string `json:"error"`
+}
+
+func isAPIPath(path string) bool {
+	return strings.HasPrefix(path, apiPrefix)
+}
+
+// The JSON API is a more structured alternative to putting the URL in the path and
+// reading timings from headers. For example;
+// `curl -d '{"url": "https://www.brow.sh", "mode": "PLAIN"}' localhost:4333/api/v1/render`
+func handleAPIRenderRequest(w http.ResponseWriter, r *http.Request) {
+	var request apiRenderRequest
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		writeAPIError(w, http.StatusMethodNotAllowed, "Only POST is supported")
+		return
+	}
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20))
+	if err := decoder.Decode(&request); err != nil {
+		writeAPIError(w, http.StatusBadRequest, "Invalid JSON body: "+err.Error())
+		return
+	}
+	if message, ok := validateAPIRenderRequest(&request); !ok {
+		writeAPIError(w, http.StatusBadRequest, message)
+		return
+	}
+	setRequestTarget(r, request.URL, request.Mode)
+	if isDisallowedDomain(request.URL) {
+		blockRequest(r, blockedDomain)
+		writeAPIError(w, http.StatusForbidden, "Forbidden")
+		return
+	}
+	if isDisallowedUserAgent(r.Header.Get("User-Agent")) {
+		blockRequest(r, blockedUserAgent)
+		writeAPIError(w, http.StatusForbidden, "Forbidden")
+		return
+	}
+	if !isURLAllowedForRequest(r, request.URL) {
+		blockRequest(r, blockedAPIKey)
+		writeAPIError(w, http.StatusForbidden, "This API key can't render "+request.URL)
+		return
+	}
+	slog.Info("Handling API render request", "url", request.URL, "mode", request.Mode)
+	request.AllowedDomains = allowedDomainsForRequest(r)
+	render, isCached, err := renderPage(
+		r.Context(), request.URL, request.Mode, request.rawTextOptions)
+	if errors.Is(err, errDisallowedDestination) {
+		blockRequest(r, blockedDestination)
+		writeAPIError(w, http.StatusForbidden, err.Error())
+		return
+	}
+	if errors.Is(err, errDisallowedByAPIKey) {
+		blockRequest(r, blockedAPIKey)
+		writeAPIError(w, http.StatusForbidden, err.Error())
+		return
+	}
+	if isRenderQueueError(err) {
+		blockRequest(r, blockedQueueFull)
+		w.Header().Set("Retry-After", renderQueue.retryAfter())
+		writeAPIError(w, http.StatusServiceUnavailable, err.Error())
+		return
+	}
+	if errors.Is(err, errNoBrowserConnected) {
+		blockRequest(r, blockedNoBrowser)
+		writeAPIError(w, http.StatusServiceUnavailable, err.Error())
+		return
+	}
+	if errors.Is(err, errRawTextTimeout) {
+		writeAPIError(w, http.StatusGatewayTimeout, rawTextTimeoutMessage(request.timeout()))
+		return
+	}
+	if errors.Is(err, context.Canceled) {
+		slog.Info("API client went away before the render finished", "url", request.URL)
+		return
+	}
+	if err != nil {
+		slog.Error("Couldn't render page for API", "url", request.URL, "error", err)
+		writeAPIError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	setRequestRender(r, render, isCached)
+	rendered := unpackResponse(render.Response)
+	w.Header().Set("ETag", render.ETag)
+	if renderCache != nil {
+		w.Header().Set("X-Browsh-Cache", cacheStatus(isCached))
+	}
+	if isETagMatch(r.Header.Get("If-None-Match"), render.ETag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	writeAPIJSON(w, http.StatusOK, apiRenderResponse{
+		Text:     rendered.Text,
+		Title:    rendered.Title,
+		URL:      request.URL,
+		FinalURL: rendered.URL,
+		Mode:     request.Mode,
+		Links:    rendered.Links,
+		Timings: apiRenderTimings{
+			Total:    render.TotalDuration,
+			Pageload: rendered.PageloadDuration,
+			Parsing:  rendered.ParsingDuration,
+		},
+	})
+}
+
+// Remove renders from the cache, so that the next request for them goes to Firefox.
+// For example;
+// `curl -H 'X-Browsh-API-Key: ...' -d '{"url": "https://www.brow.sh"}' \
+// localhost:4333/api/v1/admin/cache/purge`
+func handleAPIPurgeRequest(w http.ResponseWriter, r *http.Request) {
+	var request apiPurgeRequest
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		writeAPIError(w, http.StatusMethodNotAllowed, "Only POST is supported")
+		return
+	}
+	if renderCache == nil {
+		writeAPIError(w, http.StatusNotFound, "Caching is not turned on")
+		return
+	}
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20))
+	if err := decoder.Decode(&request); err != nil && err != io.EOF {
+		writeAPIError(w, http.StatusBadRequest, "Invalid JSON body: "+err.Error())
+		return
+	}
+	purged := renderCache.purge(strings.TrimSpace(request.URL))
+	slog.Info("Purged the render cache", "url", request.URL, "purged", purged)
+	writeAPIJSON(w, http.StatusOK, apiPurgeResponse{Purged: purged})
+}
+
+func validateAPIRenderRequest(request *apiRenderRequest) (string, bool) {
+	var isErrored bool
+	request.URL, isErrored = deRecurseURL(strings.TrimSpace(request.URL))
+	if isErrored {
+		return "Invalid URL", false
+	}
+	if request.URL == "" {
+		return "A 'url' is required", false
+	}
+	request.Mode = strings.ToUpper(request.Mode)
+	if request.Mode == "" {
+		request.Mode = "PLAIN"
+	}
+	if !isValidRawTextMode(request.Mode) {
+		return "Unknown mode: " + request.Mode, false
+	}
+	if err := request.validate(); err != nil {
+		return err.Error(), false
+	}
+	return "", true
+}
+
+func writeAPIJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		slog.Error("Failed to write API response", "error", err)
+	}
+}
+
+func writeAPIError(w http.ResponseWriter, status int, message string) {
+	writeAPIJSON(w, status, apiError{Error: message})
+}
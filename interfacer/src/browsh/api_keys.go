@@ -0,0 +1,219 @@
+package browsh
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-errors/errors"
+	"github.com/spf13/viper"
+)
+
+// The header that clients of the HTTP server send their API key in. Keys can also be
+// sent as a bearer token in the `Authorization` header.
+const apiKeyHeader = "X-Browsh-API-Key"
+
+// Keys from `http-server.api-keys-file`, reloaded whenever the file changes so that
+// keys can be added and revoked without restarting Browsh.
+var apiKeysFile = &apiKeysFileCache{}
+
+// A client of the HTTP server, configured in `[[http-server.api-keys]]` or in the keys
+// file
+type apiKey struct {
+	Key            string   `mapstructure:"key"`
+	RateLimit      string   `mapstructure:"rate-limit"`
+	AllowedDomains []string `mapstructure:"allowed-domains"`
+	Admin          bool     `mapstructure:"admin"`
+}
+
+type apiKeyContextKey struct{}
+
+var errDisallowedByAPIKey = errors.New("This API key can't render pages on that domain")
+
+type apiKeysFileCache struct {
+	sync.Mutex
+	path     string
+	modified time.Time
+	keys     []apiKey
+}
+
+func getAPIKeys() []apiKey {
+	var keys []apiKey
+	if err := viper.UnmarshalKey("http-server.api-keys", &keys); err != nil {
+		slog.Error("Couldn't read http-server.api-keys", "error", err)
+	}
+	return append(keys, apiKeysFile.get(viper.GetString("http-server.api-keys-file"))...)
+}
+
+// The keys file has the same format as the `[[http-server.api-keys]]` config, but
+// without the `http-server.` prefix, eg;
+//
+//	[[api-keys]]
+//	key = "a-long-random-string"
+//	allowed-domains = ["example.com"]
+func (c *apiKeysFileCache) get(path string) []apiKey {
+	if path == "" {
+		return nil
+	}
+	c.Lock()
+	defer c.Unlock()
+	info, err := os.Stat(path)
+	if err != nil {
+		slog.Error("Couldn't read the API keys file", "error", err)
+		return nil
+	}
+	if path == c.path && info.ModTime().Equal(c.modified) {
+		return c.keys
+	}
+	var keys []apiKey
+	file := viper.New()
+	file.SetConfigFile(path)
+	if err := file.ReadInConfig(); err != nil {
+		slog.Error("Couldn't read the API keys file", "error", err)
+		return nil
+	}
+	if err := file.UnmarshalKey("api-keys", &keys); err != nil {
+		slog.Error("Couldn't read the API keys file", "error", err)
+		return nil
+	}
+	c.path = path
+	c.modified = info.ModTime()
+	c.keys = keys
+	return keys
+}
+
+func getGivenAPIKey(r *http.Request) string {
+	if key := r.Header.Get(apiKeyHeader); key != "" {
+		return key
+	}
+	if token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+		return strings.TrimSpace(token)
+	}
+	return ""
+}
+
+// The configured API key that the request was made with, if any
+func findAPIKey(r *http.Request) *apiKey {
+	given := getGivenAPIKey(r)
+	if given == "" {
+		return nil
+	}
+	keys := getAPIKeys()
+	for i := range keys {
+		if subtle.ConstantTimeCompare([]byte(keys[i].Key), []byte(given)) == 1 {
+			return &keys[i]
+		}
+	}
+	return nil
+}
+
+// So that keys never end up in logs or shared stores like Redis
+func hashAPIKey(key string) string {
+	hash := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(hash[:12])
+}
+
+// Looking up a key can mean reading the keys file, so it's only done once per request,
+// by whichever of the rate limiter or `authenticate()` needs it first. The key is kept
+// in the request's context even when it's nil, so that a missing key isn't looked up
+// again either.
+func resolveAPIKey(r *http.Request) (*http.Request, *apiKey) {
+	if key, ok := r.Context().Value(apiKeyContextKey{}).(*apiKey); ok {
+		return r, key
+	}
+	key := findAPIKey(r)
+	return r.WithContext(context.WithValue(r.Context(), apiKeyContextKey{}, key)), key
+}
+
+// Look up the request's API key, for the handlers to check what it's allowed to do.
+// When `http-server.require-api-key` is on, requests without a valid key go no further.
+func authenticate(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r, key := resolveAPIKey(r)
+		if key == nil && viper.GetBool("http-server.require-api-key") {
+			setRequestRejection(r, rejectedUnauthenticated)
+			w.Header().Set("WWW-Authenticate", `Bearer realm="browsh"`)
+			http.Error(w, "A valid API key is required", http.StatusUnauthorized)
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// Admin routes always need a key, whether or not other routes do
+func requireAdmin(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := getRequestAPIKey(r)
+		if key == nil {
+			setRequestRejection(r, rejectedUnauthenticated)
+			w.Header().Set("WWW-Authenticate", `Bearer realm="browsh"`)
+			writeAPIError(w, http.StatusUnauthorized, "An admin API key is required")
+			return
+		}
+		if !key.Admin {
+			setRequestRejection(r, rejectedNotAdmin)
+			writeAPIError(w, http.StatusForbidden, "This API key is not an admin key")
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+func getRequestAPIKey(r *http.Request) *apiKey {
+	key, _ := r.Context().Value(apiKeyContextKey{}).(*apiKey)
+	return key
+}
+
+// Requests without a key, when keys aren't required, are only limited by the
+// `blocked-domains` config.
+func isURLAllowedForRequest(r *http.Request, urlForBrowsh string) bool {
+	key := getRequestAPIKey(r)
+	if key == nil {
+		return true
+	}
+	return key.isAllowedURL(urlForBrowsh)
+}
+
+// Only the URL that the client asks for is checked here, so the webextension checks
+// these too, as pages can redirect, or navigate, to anywhere. They're also part of the
+// render's cache key, so a render that ended up somewhere else is never shared with
+// keys that aren't allowed there.
+func allowedDomainsForRequest(r *http.Request) []string {
+	key := getRequestAPIKey(r)
+	if key == nil {
+		return nil
+	}
+	return key.AllowedDomains
+}
+
+// Keys without any allowed domains can render anything. Otherwise each domain also
+// allows all of its subdomains.
+func (k *apiKey) isAllowedURL(urlForBrowsh string) bool {
+	if len(k.AllowedDomains) == 0 {
+		return true
+	}
+	// Firefox treats URLs without a scheme as HTTP
+	if !strings.Contains(urlForBrowsh, "://") {
+		urlForBrowsh = "http://" + urlForBrowsh
+	}
+	parsed, err := url.Parse(urlForBrowsh)
+	if err != nil {
+		return false
+	}
+	host := strings.ToLower(parsed.Hostname())
+	for _, domain := range k.AllowedDomains {
+		domain = strings.ToLower(strings.TrimPrefix(domain, "*."))
+		if host == domain || strings.HasSuffix(host, "."+domain) {
+			return true
+		}
+	}
+	return false
+}
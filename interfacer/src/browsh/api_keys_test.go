@@ -0,0 +1,136 @@
+package browsh
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/spf13/viper"
+)
+
+func TestAPIKeys(t *testing.T) {
+	RegisterFailHandler(Fail)
+}
+
+var _ = Describe("API keys", func() {
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+
+	serve := func(handler http.Handler, request *http.Request) int {
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, request)
+		return recorder.Code
+	}
+
+	BeforeEach(func() {
+		viper.Set("http-server.api-keys", []map[string]interface{}{
+			{"key": "admin", "admin": true},
+			{"key": "limited", "allowed-domains": []string{"example.com"}},
+		})
+	})
+
+	AfterEach(func() {
+		viper.Set("http-server.api-keys", nil)
+		viper.Set("http-server.api-keys-file", "")
+		viper.Set("http-server.require-api-key", false)
+	})
+
+	Describe("Finding keys", func() {
+		It("should accept keys in the Browsh header", func() {
+			request := httptest.NewRequest("GET", "/", nil)
+			request.Header.Set(apiKeyHeader, "admin")
+			Expect(findAPIKey(request).Admin).To(BeTrue())
+		})
+		It("should accept keys as bearer tokens", func() {
+			request := httptest.NewRequest("GET", "/", nil)
+			request.Header.Set("Authorization", "Bearer limited")
+			Expect(findAPIKey(request).Key).To(Equal("limited"))
+		})
+		It("should not find unknown keys", func() {
+			request := httptest.NewRequest("GET", "/", nil)
+			request.Header.Set(apiKeyHeader, "made-up")
+			Expect(findAPIKey(request)).To(BeNil())
+		})
+		It("should read keys from the keys file", func() {
+			dir, _ := os.MkdirTemp("", "browsh-keys")
+			defer os.RemoveAll(dir)
+			path := filepath.Join(dir, "keys.toml")
+			os.WriteFile(path, []byte("[[api-keys]]\nkey = \"from-file\"\n"), 0o600)
+			viper.Set("http-server.api-keys-file", path)
+			request := httptest.NewRequest("GET", "/", nil)
+			request.Header.Set(apiKeyHeader, "from-file")
+			Expect(findAPIKey(request)).ToNot(BeNil())
+
+			os.WriteFile(path, []byte("[[api-keys]]\nkey = \"replaced\"\n"), 0o600)
+			later := time.Now().Add(time.Second)
+			os.Chtimes(path, later, later)
+			Expect(findAPIKey(request)).To(BeNil())
+		})
+	})
+
+	Describe("Authentication", func() {
+		It("should let anyone through when keys aren't required", func() {
+			request := httptest.NewRequest("GET", "/", nil)
+			Expect(serve(authenticate(ok), request)).To(Equal(http.StatusOK))
+		})
+		It("should turn away requests without a key when keys are required", func() {
+			viper.Set("http-server.require-api-key", true)
+			request := httptest.NewRequest("GET", "/", nil)
+			Expect(serve(authenticate(ok), request)).To(Equal(http.StatusUnauthorized))
+			request.Header.Set(apiKeyHeader, "limited")
+			Expect(serve(authenticate(ok), request)).To(Equal(http.StatusOK))
+		})
+		It("should only look up a request's key once", func() {
+			viper.Set("http-server.require-api-key", true)
+			request := httptest.NewRequest("GET", "/", nil)
+			request.Header.Set(apiKeyHeader, "limited")
+			request, _ = resolveAPIKey(request)
+			viper.Set("http-server.api-keys", nil)
+			Expect(serve(authenticate(ok), request)).To(Equal(http.StatusOK))
+		})
+		It("should only let admin keys use admin routes", func() {
+			handler := authenticate(requireAdmin(ok))
+			request := httptest.NewRequest("POST", apiPurgePath, nil)
+			Expect(serve(handler, request)).To(Equal(http.StatusUnauthorized))
+			request.Header.Set(apiKeyHeader, "limited")
+			Expect(serve(handler, request)).To(Equal(http.StatusForbidden))
+			request.Header.Set(apiKeyHeader, "admin")
+			Expect(serve(handler, request)).To(Equal(http.StatusOK))
+		})
+	})
+
+	Describe("Allowed domains", func() {
+		key := apiKey{AllowedDomains: []string{"example.com"}}
+
+		It("should allow the domain and its subdomains", func() {
+			Expect(key.isAllowedURL("https://example.com/page")).To(BeTrue())
+			Expect(key.isAllowedURL("https://www.example.com")).To(BeTrue())
+			Expect(key.isAllowedURL("example.com/page")).To(BeTrue())
+		})
+		It("should not allow other domains", func() {
+			Expect(key.isAllowedURL("https://notexample.com")).To(BeFalse())
+			Expect(key.isAllowedURL("https://example.com.evil.com")).To(BeFalse())
+			Expect(key.isAllowedURL("view-source:https://evil.com")).To(BeFalse())
+			Expect(key.isAllowedURL("search terms")).To(BeFalse())
+		})
+		It("should allow anything for keys without allowed domains", func() {
+			Expect((&apiKey{}).isAllowedURL("https://anywhere.com")).To(BeTrue())
+		})
+		It("should give renders the allowed domains of the request's key", func() {
+			request := httptest.NewRequest("GET", "/", nil)
+			request.Header.Set(apiKeyHeader, "limited")
+			request, _ = resolveAPIKey(request)
+			Expect(allowedDomainsForRequest(request)).To(Equal([]string{"example.com"}))
+			Expect(allowedDomainsForRequest(httptest.NewRequest("GET", "/", nil))).To(BeNil())
+		})
+		It("should cache renders separately for keys with allowed domains", func() {
+			limited := rawTextOptions{AllowedDomains: []string{"example.com"}}
+			Expect(renderCacheKey("https://example.com", "PLAIN", limited)).ToNot(
+				Equal(renderCacheKey("https://example.com", "PLAIN", rawTextOptions{})))
+		})
+	})
+})
@@ -0,0 +1,104 @@
+package browsh
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/spf13/viper"
+)
+
+func TestAPI(t *testing.T) {
+	RegisterFailHandler(Fail)
+}
+
+var _ = Describe("JSON API", func() {
+	Describe("Validating render requests", func() {
+		It("should default to PLAIN mode", func() {
+			request := apiRenderRequest{URL: " https://www.brow.sh "}
+			_, ok := validateAPIRenderRequest(&request)
+			Expect(ok).To(BeTrue())
+			Expect(request.URL).To(Equal("https://www.brow.sh"))
+			Expect(request.Mode).To(Equal("PLAIN"))
+		})
+		It("should require a URL", func() {
+			request := apiRenderRequest{Mode: "html"}
+			_, ok := validateAPIRenderRequest(&request)
+			Expect(ok).To(BeFalse())
+		})
+		It("should reject unknown modes", func() {
+			request := apiRenderRequest{URL: "https://www.brow.sh", Mode: "PDF"}
+			message, ok := validateAPIRenderRequest(&request)
+			Expect(ok).To(BeFalse())
+			Expect(message).To(ContainSubstring("PDF"))
+		})
+	})
+
+	Describe("Handling render requests", func() {
+		It("should only accept POSTs", func() {
+			recorder := httptest.NewRecorder()
+			request := httptest.NewRequest("GET", apiRenderPath, nil)
+			handleAPIRenderRequest(recorder, request)
+			Expect(recorder.Code).To(Equal(http.StatusMethodNotAllowed))
+			Expect(recorder.Body.String()).To(ContainSubstring(`"error"`))
+		})
+		It("should reject invalid JSON", func() {
+			recorder := httptest.NewRecorder()
+			request := httptest.NewRequest("POST", apiRenderPath, strings.NewReader("{"))
+			handleAPIRenderRequest(recorder, request)
+			Expect(recorder.Code).To(Equal(http.StatusBadRequest))
+		})
+		It("should answer with an error when the render fails", func() {
+			viper.Set("http-server.timeout", 5)
+			defer viper.Set("http-server.timeout", 0)
+			rejectWaitingRenders(errors.New("The webextension couldn't render the page"))
+			recorder := httptest.NewRecorder()
+			body := strings.NewReader(`{"url": "https://a.com"}`)
+			handleAPIRenderRequest(recorder, httptest.NewRequest("POST", apiRenderPath, body))
+			Expect(recorder.Code).To(Equal(http.StatusInternalServerError))
+			Expect(recorder.Body.String()).To(ContainSubstring(`"error"`))
+		})
+		It("should say when the client already has the render", func() {
+			renderCache = newMemoryRenderStore(time.Minute, 1024)
+			defer func() { renderCache = nil }()
+			render := newCachedRender("https://a.com", "PLAIN", `{"body": "text"}`, 1)
+			renderCache.set(renderCacheKey("https://a.com", "PLAIN", rawTextOptions{}), render)
+			recorder := httptest.NewRecorder()
+			body := strings.NewReader(`{"url": "https://a.com"}`)
+			request := httptest.NewRequest("POST", apiRenderPath, body)
+			request.Header.Set("If-None-Match", render.ETag)
+			handleAPIRenderRequest(recorder, request)
+			Expect(recorder.Code).To(Equal(http.StatusNotModified))
+			Expect(recorder.Body.String()).To(BeEmpty())
+		})
+	})
+
+	Describe("Handling purge requests", func() {
+		AfterEach(func() {
+			renderCache = nil
+		})
+
+		It("should say when there's no cache to purge", func() {
+			recorder := httptest.NewRecorder()
+			request := httptest.NewRequest("POST", apiPurgePath, strings.NewReader("{}"))
+			handleAPIPurgeRequest(recorder, request)
+			Expect(recorder.Code).To(Equal(http.StatusNotFound))
+		})
+		It("should purge the given URL", func() {
+			renderCache = newMemoryRenderStore(time.Minute, 1024)
+			renderCache.set("a", newCachedRender("https://a.com", "PLAIN", "{}", 1))
+			renderCache.set("b", newCachedRender("https://b.com", "PLAIN", "{}", 1))
+			recorder := httptest.NewRecorder()
+			body := strings.NewReader(`{"url": "https://a.com"}`)
+			request := httptest.NewRequest("POST", apiPurgePath, body)
+			handleAPIPurgeRequest(recorder, request)
+			Expect(recorder.Code).To(Equal(http.StatusOK))
+			Expect(recorder.Body.String()).To(MatchJSON(`{"purged": 1}`))
+		})
+	})
+})
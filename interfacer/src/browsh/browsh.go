@@ -80,6 +80,7 @@ func Shutdown(err error) {
 	if screen != nil {
 		screen.Fini()
 	}
+	unshareWebsocketToken()
 	exitCode := 0
 	if !errors.Is(err, errNormalExit) {
 		exitCode = 1
@@ -111,7 +112,7 @@ func saveScreenshot(base64String string) {
 		Shutdown(err)
 	}
 	message := "Screenshot saved to " + fullPath
-	sendMessageToWebExtension("/status," + message)
+	sendCommandToWebExtension("/status", statusPayload{Message: message})
 }
 
 // Shell provides nice and easy shell commands
@@ -181,7 +182,8 @@ func ttyEntry() {
 	TTYStart(realScreen)
 }
 
-// MainEntry decides between running Browsh as a CLI app or as an HTTP web server
+// MainEntry decides between running Browsh as a CLI app, as an HTTP web server or as a
+// one-off dump of a single page
 func MainEntry() {
 	pflag.Parse()
 	// validURL contains array of valid user inputted links.
@@ -209,9 +211,11 @@ func MainEntry() {
 		os.Exit(0)
 	}
 
-	// Decide whether to run in http-server-mode or CLI app
+	// Decide whether to run in http-server-mode, dump mode or CLI app
 	if viper.GetBool("http-server-mode") {
 		HTTPServerStart()
+	} else if viper.GetBool("dump") {
+		DumpStart()
 	} else {
 		ttyEntry()
 	}
@@ -0,0 +1,328 @@
+package browsh
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-errors/errors"
+	"github.com/spf13/viper"
+)
+
+// The HTTP server's cache of finished renders, nil when caching is turned off
+var renderCache renderStore
+
+// The "Built on <date> in <time>" line that the webextension adds to every render's footer
+var renderTimingLine = regexp.MustCompile(`\n\nBuilt [^\n]* in \d+ms\.`)
+
+// A finished render, as it is sent back to clients and kept in the cache
+type cachedRender struct {
+	URL           string    `json:"url"`
+	Mode          string    `json:"mode"`
+	Response      string    `json:"response"`
+	TotalDuration int       `json:"total_duration"`
+	ETag          string    `json:"etag"`
+	Created       time.Time `json:"created"`
+}
+
+// Both the in-memory and on-disk caches are bounded by age and by the total size of
+// their renders. Purging by URL removes every mode and set of render options for it,
+// an empty URL purges everything.
+type renderStore interface {
+	get(key string) (*cachedRender, bool)
+	set(key string, render *cachedRender)
+	purge(urlForBrowsh string) int
+}
+
+func newCachedRender(urlForBrowsh, mode, response string, totalDuration int) *cachedRender {
+	return &cachedRender{
+		URL:           urlForBrowsh,
+		Mode:          mode,
+		Response:      response,
+		TotalDuration: totalDuration,
+		ETag:          renderETag(response),
+		Created:       time.Now(),
+	}
+}
+
+// ETags only depend on what was rendered, not on when or how quickly, so that a page
+// that hasn't changed keeps the same ETag every time it's rendered.
+func renderETag(response string) string {
+	rendered := unpackResponse(response)
+	content, _ := json.Marshal(rawTextResponse{
+		Text:  renderTimingLine.ReplaceAllString(rendered.Text, ""),
+		Title: rendered.Title,
+		URL:   rendered.URL,
+		Links: rendered.Links,
+	})
+	hash := sha256.Sum256(content)
+	return `"` + hex.EncodeToString(hash[:16]) + `"`
+}
+
+func (c *cachedRender) size() int {
+	return len(c.Response) + len(c.URL)
+}
+
+func (c *cachedRender) isExpired(ttl time.Duration) bool {
+	return time.Since(c.Created) > ttl
+}
+
+func setupRenderCache() {
+	ttl := time.Duration(viper.GetInt("http-server.cache-ttl")) * time.Second
+	maxSize := viper.GetInt("http-server.cache-max-size") * 1024 * 1024
+	switch viper.GetString("http-server.cache") {
+	case "":
+		renderCache = nil
+	case "memory":
+		renderCache = newMemoryRenderStore(ttl, maxSize)
+	case "disk":
+		store, err := newDiskRenderStore(filepath.Join(getConfigDir(), "cache"), ttl, maxSize)
+		if err != nil {
+			Shutdown(err)
+		}
+		renderCache = store
+	default:
+		Shutdown(errors.New("Unknown http-server.cache: " + viper.GetString("http-server.cache")))
+	}
+}
+
+// Renders are the same for the same URL, mode and render options. The URL's own hash
+// is kept separate so that all the renders of a URL can be found when purging.
+func renderCacheKey(urlForBrowsh, mode string, options rawTextOptions) string {
+	encodedOptions, _ := json.Marshal(options)
+	return hashForCache(urlForBrowsh) + "-" + hashForCache(mode+"\n"+string(encodedOptions))
+}
+
+func hashForCache(value string) string {
+	hash := sha256.Sum256([]byte(value))
+	return hex.EncodeToString(hash[:12])
+}
+
+// Whether the client already has the exact same render as the one we're about to send
+func isETagMatch(ifNoneMatch, etag string) bool {
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == etag || candidate == "*" {
+			return true
+		}
+	}
+	return false
+}
+
+type memoryRenderStore struct {
+	sync.Mutex
+	ttl     time.Duration
+	maxSize int
+	size    int
+	// Most recently used at the front
+	order   *list.List
+	entries map[string]*list.Element
+}
+
+type memoryRenderEntry struct {
+	key    string
+	render *cachedRender
+}
+
+func newMemoryRenderStore(ttl time.Duration, maxSize int) *memoryRenderStore {
+	return &memoryRenderStore{
+		ttl:     ttl,
+		maxSize: maxSize,
+		order:   list.New(),
+		entries: make(map[string]*list.Element),
+	}
+}
+
+func (m *memoryRenderStore) get(key string) (*cachedRender, bool) {
+	m.Lock()
+	defer m.Unlock()
+	element, ok := m.entries[key]
+	if !ok {
+		return nil, false
+	}
+	entry := element.Value.(*memoryRenderEntry)
+	if entry.render.isExpired(m.ttl) {
+		m.removeElement(element)
+		return nil, false
+	}
+	m.order.MoveToFront(element)
+	return entry.render, true
+}
+
+func (m *memoryRenderStore) set(key string, render *cachedRender) {
+	if render.size() > m.maxSize {
+		return
+	}
+	m.Lock()
+	defer m.Unlock()
+	if element, ok := m.entries[key]; ok {
+		m.removeElement(element)
+	}
+	m.entries[key] = m.order.PushFront(&memoryRenderEntry{key: key, render: render})
+	m.size += render.size()
+	for m.size > m.maxSize {
+		m.removeElement(m.order.Back())
+	}
+}
+
+func (m *memoryRenderStore) purge(urlForBrowsh string) int {
+	m.Lock()
+	defer m.Unlock()
+	purged := 0
+	for _, element := range m.entries {
+		render := element.Value.(*memoryRenderEntry).render
+		if urlForBrowsh == "" || render.URL == urlForBrowsh {
+			m.removeElement(element)
+			purged++
+		}
+	}
+	return purged
+}
+
+func (m *memoryRenderStore) removeElement(element *list.Element) {
+	entry := element.Value.(*memoryRenderEntry)
+	m.order.Remove(element)
+	delete(m.entries, entry.key)
+	m.size -= entry.render.size()
+}
+
+// Each render is a JSON file named after its cache key. An index of file sizes is kept
+// in memory so that the cache's total size can be bounded without walking the folder
+// on every write.
+type diskRenderStore struct {
+	sync.Mutex
+	dir     string
+	ttl     time.Duration
+	maxSize int
+	size    int
+	files   map[string]diskRenderFile
+}
+
+type diskRenderFile struct {
+	size     int
+	modified time.Time
+}
+
+func newDiskRenderStore(dir string, ttl time.Duration, maxSize int) (*diskRenderStore, error) {
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return nil, err
+	}
+	store := &diskRenderStore{
+		dir:     dir,
+		ttl:     ttl,
+		maxSize: maxSize,
+		files:   make(map[string]diskRenderFile),
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil || !strings.HasSuffix(entry.Name(), ".json") {
+			continue
+		}
+		key := strings.TrimSuffix(entry.Name(), ".json")
+		store.files[key] = diskRenderFile{size: int(info.Size()), modified: info.ModTime()}
+		store.size += int(info.Size())
+	}
+	store.Lock()
+	store.evict()
+	store.Unlock()
+	return store, nil
+}
+
+func (d *diskRenderStore) path(key string) string {
+	return filepath.Join(d.dir, key+".json")
+}
+
+func (d *diskRenderStore) get(key string) (*cachedRender, bool) {
+	var render cachedRender
+	d.Lock()
+	defer d.Unlock()
+	if _, ok := d.files[key]; !ok {
+		return nil, false
+	}
+	contents, err := os.ReadFile(d.path(key))
+	if err == nil {
+		err = json.Unmarshal(contents, &render)
+	}
+	if err != nil || render.isExpired(d.ttl) {
+		d.remove(key)
+		return nil, false
+	}
+	return &render, true
+}
+
+func (d *diskRenderStore) set(key string, render *cachedRender) {
+	contents, err := json.Marshal(render)
+	if err != nil || len(contents) > d.maxSize {
+		return
+	}
+	d.Lock()
+	defer d.Unlock()
+	if err := os.WriteFile(d.path(key), contents, 0o600); err != nil {
+		slog.Error("Couldn't write to the render cache", "error", err)
+		return
+	}
+	d.size -= d.files[key].size
+	d.files[key] = diskRenderFile{size: len(contents), modified: time.Now()}
+	d.size += len(contents)
+	d.evict()
+}
+
+func (d *diskRenderStore) purge(urlForBrowsh string) int {
+	d.Lock()
+	defer d.Unlock()
+	purged := 0
+	prefix := hashForCache(urlForBrowsh) + "-"
+	for key := range d.files {
+		if urlForBrowsh == "" || strings.HasPrefix(key, prefix) {
+			d.remove(key)
+			purged++
+		}
+	}
+	return purged
+}
+
+func (d *diskRenderStore) remove(key string) {
+	if err := os.Remove(d.path(key)); err != nil && !os.IsNotExist(err) {
+		slog.Error("Couldn't remove from the render cache", "error", err)
+	}
+	d.size -= d.files[key].size
+	delete(d.files, key)
+}
+
+// Remove expired renders, and then the oldest ones until the cache fits in its maximum
+// size.
+func (d *diskRenderStore) evict() {
+	var keys []string
+	for key, file := range d.files {
+		if time.Since(file.modified) > d.ttl {
+			d.remove(key)
+			continue
+		}
+		keys = append(keys, key)
+	}
+	if d.size <= d.maxSize {
+		return
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return d.files[keys[i]].modified.Before(d.files[keys[j]].modified)
+	})
+	for _, key := range keys {
+		if d.size <= d.maxSize {
+			return
+		}
+		d.remove(key)
+	}
+}
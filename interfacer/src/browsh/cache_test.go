@@ -0,0 +1,139 @@
+package browsh
+
+import (
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+func TestCache(t *testing.T) {
+	RegisterFailHandler(Fail)
+}
+
+func renderFor(urlForBrowsh, text string) *cachedRender {
+	return newCachedRender(urlForBrowsh, "PLAIN", `{"body": "`+text+`"}`, 10)
+}
+
+var _ = Describe("Render cache", func() {
+	Describe("Keys", func() {
+		It("should differ by render options", func() {
+			first := renderCacheKey("https://www.brow.sh", "PLAIN", rawTextOptions{})
+			second := renderCacheKey("https://www.brow.sh", "PLAIN", rawTextOptions{Columns: 40})
+			Expect(first).ToNot(Equal(second))
+		})
+		It("should share a prefix for the same URL", func() {
+			first := renderCacheKey("https://www.brow.sh", "PLAIN", rawTextOptions{})
+			second := renderCacheKey("https://www.brow.sh", "HTML", rawTextOptions{})
+			Expect(strings.Split(first, "-")[0]).To(Equal(strings.Split(second, "-")[0]))
+		})
+	})
+
+	Describe("ETags", func() {
+		It("should match any of the client's ETags", func() {
+			Expect(isETagMatch(`"abc", W/"def"`, `"def"`)).To(BeTrue())
+			Expect(isETagMatch(`"abc"`, `"def"`)).To(BeFalse())
+			Expect(isETagMatch("", `"def"`)).To(BeFalse())
+		})
+		It("should be the same for the same render", func() {
+			Expect(renderFor("a", "text").ETag).To(Equal(renderFor("a", "text").ETag))
+			Expect(renderFor("a", "text").ETag).ToNot(Equal(renderFor("a", "other").ETag))
+		})
+		It("should ignore timings", func() {
+			first := newCachedRender("a", "PLAIN",
+				`{"body": "text\n\nBuilt by Browsh v1.8.0 on 19/10/2026 at 10:01 in 120ms.",`+
+					`"page_load_duration": 900}`, 1000)
+			second := newCachedRender("a", "PLAIN",
+				`{"body": "text\n\nBuilt by Browsh v1.8.0 on 19/10/2026 at 10:05 in 85ms.",`+
+					`"page_load_duration": 700}`, 800)
+			Expect(first.ETag).To(Equal(second.ETag))
+			Expect(first.ETag).To(Equal(renderFor("a", "text").ETag))
+		})
+	})
+
+	Describe("In memory", func() {
+		It("should return what was stored", func() {
+			store := newMemoryRenderStore(time.Minute, 1024)
+			store.set("key", renderFor("https://a.com", "text"))
+			render, ok := store.get("key")
+			Expect(ok).To(BeTrue())
+			Expect(render.URL).To(Equal("https://a.com"))
+		})
+		It("should expire old renders", func() {
+			store := newMemoryRenderStore(time.Minute, 1024)
+			render := renderFor("https://a.com", "text")
+			render.Created = time.Now().Add(-2 * time.Minute)
+			store.set("key", render)
+			_, ok := store.get("key")
+			Expect(ok).To(BeFalse())
+		})
+		It("should evict the least recently used renders when full", func() {
+			size := renderFor("https://a.com", "text").size()
+			store := newMemoryRenderStore(time.Minute, size*2)
+			store.set("a", renderFor("https://a.com", "text"))
+			store.set("b", renderFor("https://b.com", "text"))
+			store.get("a")
+			store.set("c", renderFor("https://c.com", "text"))
+			_, hasA := store.get("a")
+			_, hasB := store.get("b")
+			Expect(hasA).To(BeTrue())
+			Expect(hasB).To(BeFalse())
+		})
+		It("should purge every render of a URL", func() {
+			store := newMemoryRenderStore(time.Minute, 1024)
+			store.set("a1", renderFor("https://a.com", "text"))
+			store.set("a2", renderFor("https://a.com", "other"))
+			store.set("b", renderFor("https://b.com", "text"))
+			Expect(store.purge("https://a.com")).To(Equal(2))
+			Expect(store.purge("")).To(Equal(1))
+		})
+	})
+
+	Describe("On disk", func() {
+		var dir string
+
+		BeforeEach(func() {
+			dir, _ = os.MkdirTemp("", "browsh-cache")
+		})
+
+		AfterEach(func() {
+			os.RemoveAll(dir)
+		})
+
+		It("should keep renders between restarts", func() {
+			key := renderCacheKey("https://a.com", "PLAIN", rawTextOptions{})
+			store, err := newDiskRenderStore(dir, time.Minute, 1024)
+			Expect(err).ToNot(HaveOccurred())
+			store.set(key, renderFor("https://a.com", "text"))
+			store, err = newDiskRenderStore(dir, time.Minute, 1024)
+			Expect(err).ToNot(HaveOccurred())
+			render, ok := store.get(key)
+			Expect(ok).To(BeTrue())
+			Expect(render.Response).To(ContainSubstring("text"))
+		})
+		It("should stay within its maximum size", func() {
+			store, _ := newDiskRenderStore(dir, time.Minute, 400)
+			for _, name := range []string{"a", "b", "c", "d"} {
+				store.set(name, renderFor("https://"+name+".com", "text"))
+			}
+			Expect(store.size).To(BeNumerically("<=", 400))
+			files, _ := os.ReadDir(dir)
+			Expect(len(files)).To(Equal(len(store.files)))
+		})
+		It("should purge every render of a URL", func() {
+			store, _ := newDiskRenderStore(dir, time.Minute, 4096)
+			store.set(renderCacheKey("https://a.com", "PLAIN", rawTextOptions{}),
+				renderFor("https://a.com", "text"))
+			store.set(renderCacheKey("https://a.com", "HTML", rawTextOptions{}),
+				renderFor("https://a.com", "text"))
+			store.set(renderCacheKey("https://b.com", "HTML", rawTextOptions{}),
+				renderFor("https://b.com", "text"))
+			Expect(store.purge("https://a.com")).To(Equal(2))
+			files, _ := os.ReadDir(dir)
+			Expect(files).To(HaveLen(1))
+		})
+	})
+})
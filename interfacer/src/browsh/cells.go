@@ -2,10 +2,16 @@ package browsh
 
 import (
 	"sync"
+	"sync/atomic"
 
 	"github.com/gdamore/tcell"
 )
 
+// The number of rows in each chunk of a `denseGrid`. Small enough that a page which is
+// only partially loaded doesn't use much memory, big enough that a screenful of rows
+// usually only touches one or two chunks.
+const gridChunkRows = 64
+
 // A cell represents an individual TTY cell. An entire representation of the browser
 // DOM is stored in a local in-memory "frame". The TTY can then quickly render a region
 // of this frame for fast scrolling.
@@ -15,28 +21,87 @@ type cell struct {
 	bgColour  tcell.Color
 }
 
-// Both updating a frame and scrolling a frame can happen at the same time, so we need
-// to use mutexes.
-type threadSafeCellsMap struct {
+// A frame's cells, or its raw data, indexed like the frame is, by
+// `(y * totalWidth) + x`. Pages can be very tall, so rows are stored in chunks that are
+// only allocated once something is stored in them.
+//
+// Both updating a frame and scrolling a frame can happen at the same time, so each chunk
+// has its own lock. That way rendering only waits for an update to the same rows.
+type denseGrid[T any] struct {
+	width  int
+	rows   int
+	chunks []atomic.Pointer[gridChunk[T]]
+}
+
+type gridChunk[T any] struct {
 	sync.RWMutex
-	internal map[int]cell
+	values []T
+	isSet  []bool
 }
 
-func newCellsMap() *threadSafeCellsMap {
-	return &threadSafeCellsMap{
-		internal: make(map[int]cell),
+func newDenseGrid[T any](width, rows int) *denseGrid[T] {
+	if width < 0 || rows < 0 {
+		width, rows = 0, 0
+	}
+	return &denseGrid[T]{
+		width:  width,
+		rows:   rows,
+		chunks: make([]atomic.Pointer[gridChunk[T]], (rows+gridChunkRows-1)/gridChunkRows),
 	}
 }
 
-func (m *threadSafeCellsMap) load(key int) (value cell, ok bool) {
-	m.RLock()
-	result, ok := m.internal[key]
-	m.RUnlock()
-	return result, ok
+func newCellsGrid(width, rows int) *denseGrid[cell] {
+	return newDenseGrid[cell](width, rows)
+}
+
+// Text and pixels frames each rebuild their own grid, so either grid can still be
+// sized for the DOM before it changed size. A nil grid has no size.
+func (g *denseGrid[T]) hasSize(width, rows int) bool {
+	return g != nil && g.width == width && g.rows == rows
+}
+
+// Returns the chunk for an index and the index's position in it. The chunk is nil when
+// nothing has been stored in it yet.
+func (g *denseGrid[T]) locate(index int) (*gridChunk[T], int, bool) {
+	if index < 0 || index >= g.width*g.rows {
+		return nil, 0, false
+	}
+	chunkIndex := index / (g.width * gridChunkRows)
+	return g.chunks[chunkIndex].Load(), index % (g.width * gridChunkRows), true
 }
 
-func (m *threadSafeCellsMap) store(key int, value cell) {
-	m.Lock()
-	m.internal[key] = value
-	m.Unlock()
+func (g *denseGrid[T]) load(index int) (value T, ok bool) {
+	chunk, position, _ := g.locate(index)
+	if chunk == nil {
+		return value, false
+	}
+	chunk.RLock()
+	value, ok = chunk.values[position], chunk.isSet[position]
+	chunk.RUnlock()
+	return value, ok
+}
+
+// Anything outside of the grid is dropped, it could never be rendered anyway
+func (g *denseGrid[T]) store(index int, value T) {
+	chunk, position, ok := g.locate(index)
+	if !ok {
+		return
+	}
+	if chunk == nil {
+		chunk = g.allocate(index / (g.width * gridChunkRows))
+	}
+	chunk.Lock()
+	chunk.values[position] = value
+	chunk.isSet[position] = true
+	chunk.Unlock()
+}
+
+// Only one chunk is kept if two goroutines both allocate the same one
+func (g *denseGrid[T]) allocate(chunkIndex int) *gridChunk[T] {
+	size := g.width * gridChunkRows
+	chunk := &gridChunk[T]{values: make([]T, size), isSet: make([]bool, size)}
+	if g.chunks[chunkIndex].CompareAndSwap(nil, chunk) {
+		return chunk
+	}
+	return g.chunks[chunkIndex].Load()
 }
@@ -0,0 +1,171 @@
+package browsh
+
+import (
+	"sync"
+	"testing"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+func TestCells(t *testing.T) {
+	RegisterFailHandler(Fail)
+}
+
+var _ = Describe("Dense grid", func() {
+	It("should only have what has been stored", func() {
+		grid := newCellsGrid(3, 4)
+		grid.store(5, cell{character: []rune("a")})
+		result, ok := grid.load(5)
+		Expect(ok).To(BeTrue())
+		Expect(string(result.character)).To(Equal("a"))
+		_, ok = grid.load(4)
+		Expect(ok).To(BeFalse())
+	})
+
+	It("should drop cells outside of the page", func() {
+		grid := newCellsGrid(3, 4)
+		grid.store(-1, cell{})
+		grid.store(12, cell{})
+		_, ok := grid.load(12)
+		Expect(ok).To(BeFalse())
+		_, ok = grid.load(-1)
+		Expect(ok).To(BeFalse())
+	})
+
+	It("should only allocate the rows that are used", func() {
+		grid := newCellsGrid(10, gridChunkRows*100)
+		grid.store(10*gridChunkRows*50, cell{})
+		allocated := 0
+		for i := range grid.chunks {
+			if grid.chunks[i].Load() != nil {
+				allocated++
+			}
+		}
+		Expect(allocated).To(Equal(1))
+	})
+
+	It("should be safe to update and render at the same time", func() {
+		grid := newCellsGrid(10, gridChunkRows*2)
+		var wg sync.WaitGroup
+		for writer := 0; writer < 4; writer++ {
+			wg.Add(2)
+			go func() {
+				defer wg.Done()
+				for i := 0; i < 10*gridChunkRows*2; i++ {
+					grid.store(i, cell{character: []rune("a")})
+				}
+			}()
+			go func() {
+				defer wg.Done()
+				for i := 0; i < 10*gridChunkRows*2; i++ {
+					grid.load(i)
+				}
+			}()
+		}
+		wg.Wait()
+		_, ok := grid.load(10*gridChunkRows*2 - 1)
+		Expect(ok).To(BeTrue())
+	})
+})
+
+type cellStore interface {
+	load(index int) (cell, bool)
+	store(index int, value cell)
+}
+
+// How frames used to store their cells, kept to benchmark against
+type threadSafeCellsMap struct {
+	sync.RWMutex
+	internal map[int]cell
+}
+
+func (m *threadSafeCellsMap) load(key int) (value cell, ok bool) {
+	m.RLock()
+	result, ok := m.internal[key]
+	m.RUnlock()
+	return result, ok
+}
+
+func (m *threadSafeCellsMap) store(key int, value cell) {
+	m.Lock()
+	m.internal[key] = value
+	m.Unlock()
+}
+
+var cellStores = map[string]func(width, rows int) cellStore{
+	"map": func(_, _ int) cellStore {
+		return &threadSafeCellsMap{internal: make(map[int]cell)}
+	},
+	"grid": func(width, rows int) cellStore {
+		return newCellsGrid(width, rows)
+	},
+}
+
+const (
+	benchmarkPageWidth  = 200
+	benchmarkPageRows   = 10000
+	benchmarkTTYColumns = 200
+	benchmarkTTYRows    = 50
+)
+
+// The cells built from the frames in `frame_builder_test.go`
+func benchmarkFixtureCells() []cell {
+	newTab(1)
+	parseJSONFrameText(frameJSONText)
+	parseJSONFramePixels(frameJSONPixels)
+	frame := &Tabs[1].frame
+	cells := make([]cell, frame.totalWidth*frame.domRowCount())
+	for i := range cells {
+		cells[i], _ = frame.cells.load(i)
+	}
+	return cells
+}
+
+// A long page made by repeating the fixture's cells
+func fillBenchmarkPage(cells cellStore, fixture []cell) {
+	for i := 0; i < benchmarkPageWidth*benchmarkPageRows; i++ {
+		cells.store(i, fixture[i%len(fixture)])
+	}
+}
+
+func BenchmarkBuildLongPage(b *testing.B) {
+	fixture := benchmarkFixtureCells()
+	for name, newStore := range cellStores {
+		b.Run(name, func(b *testing.B) {
+			b.ReportAllocs()
+			for n := 0; n < b.N; n++ {
+				fillBenchmarkPage(newStore(benchmarkPageWidth, benchmarkPageRows), fixture)
+			}
+		})
+	}
+}
+
+// Like `renderCurrentTabWindow()`, one lookup per TTY cell, scrolling down the page
+func BenchmarkRenderLongPage(b *testing.B) {
+	fixture := benchmarkFixtureCells()
+	for name, newStore := range cellStores {
+		b.Run(name, func(b *testing.B) {
+			cells := newStore(benchmarkPageWidth, benchmarkPageRows)
+			fillBenchmarkPage(cells, fixture)
+			b.ResetTimer()
+			for n := 0; n < b.N; n++ {
+				yScroll := (n * benchmarkTTYRows) % (benchmarkPageRows - benchmarkTTYRows)
+				for y := 0; y < benchmarkTTYRows; y++ {
+					for x := 0; x < benchmarkTTYColumns; x++ {
+						cells.load(((y + yScroll) * benchmarkPageWidth) + x)
+					}
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkParseFixtureFrames(b *testing.B) {
+	b.ReportAllocs()
+	newTab(1)
+	for n := 0; n < b.N; n++ {
+		parseJSONFrameText(frameJSONText)
+		parseJSONFramePixels(frameJSONPixels)
+	}
+}
@@ -5,7 +5,7 @@ import (
 	"fmt"
 	"log/slog"
 	"net/http"
-	"strings"
+	"sync"
 
 	"github.com/go-errors/errors"
 	"github.com/gorilla/websocket"
@@ -14,163 +14,420 @@ import (
 
 var (
 	upgrader = websocket.Upgrader{
-		CheckOrigin:     func(r *http.Request) bool { return true },
+		CheckOrigin:     isWebextensionOrigin,
 		ReadBufferSize:  1024,
 		WriteBufferSize: 1024,
 	}
-	stdinChannel              = make(chan string)
-	IsConnectedToWebExtension = false
+	// The webextension of the single Firefox, when there isn't a browser pool
+	webextension = &webextensionLink{}
 )
 
-type incomingRawText struct {
-	RequestID string `json:"request_id"`
-	RawJSON   string `json:"json"`
+const (
+	// The most messages a connection queues up before senders have to wait
+	outgoingQueueSize = 100
+	// The most messages kept for a disconnected webextension, the oldest are dropped
+	// first
+	maxPendingMessages = 1000
+)
+
+// A single websocket connection to a webextension. Each connection has its own queue of
+// outgoing messages, so nothing meant for an old connection can end up on a new one.
+type webextensionConn struct {
+	ws        *websocket.Conn
+	outgoing  chan string
+	closed    chan struct{}
+	closeOnce sync.Once
+	// Closed once the writer has stopped, after which `failed` no longer changes
+	writerStopped chan struct{}
+	// The message that was being written when the connection failed
+	failed string
+}
+
+// Firefox can restart its webextension at any time, so the single Firefox's webextension
+// is kept track of across connections. Whatever is sent while it's disconnected is kept
+// and sent once it reconnects.
+type webextensionLink struct {
+	sync.Mutex
+	conn         *webextensionConn
+	pending      []string
+	hasConnected bool
 }
 
 func startWebSocketServer() {
 	serverMux := http.NewServeMux()
 	serverMux.HandleFunc("/", webSocketServer)
-	port := viper.GetString("browsh.websocket-port")
-	slog.Info("Starting websocket server...")
-	if netErr := http.ListenAndServe(":"+port, serverMux); netErr != nil {
+	// Anything that can connect to the websocket can control Firefox
+	address := viper.GetString("browsh.websocket-bind") + ":" +
+		viper.GetString("browsh.websocket-port")
+	slog.Info("Starting websocket server...", "address", address)
+	if netErr := http.ListenAndServe(address, serverMux); netErr != nil {
 		Shutdown(fmt.Errorf("Error starting websocket server: %w", netErr))
 	}
 }
 
-func sendMessageToWebExtension(message string) {
-	if !IsConnectedToWebExtension {
-		slog.Info("Webextension not connected. Message not sent", "message", message)
-		return
+func sendMessageToWebExtension(message webextensionMessage) {
+	webextension.send(message.encode())
+}
+
+func sendCommandToWebExtension(command string, payload interface{}) {
+	sendMessageToWebExtension(newWebextensionMessage(command, payload))
+}
+
+// For the content script of the tab that's currently shown
+func sendTabCommand(command string, payload interface{}) {
+	sendMessageToWebExtension(newTabMessage("/tab_command", CurrentTab.ID,
+		tabCommandPayload{Command: command, Payload: payload}))
+}
+
+func newWebextensionConn(ws *websocket.Conn) *webextensionConn {
+	return &webextensionConn{
+		ws:            ws,
+		outgoing:      make(chan string, outgoingQueueSize),
+		closed:        make(chan struct{}),
+		writerStopped: make(chan struct{}),
+	}
+}
+
+// Read and write the websocket until either side closes it, then call `onClose`
+func (c *webextensionConn) start(onClose func()) {
+	go c.read(onClose)
+	go c.write()
+}
+
+// Returns false when the connection has closed, so the message wasn't sent
+func (c *webextensionConn) send(message string) bool {
+	// `select` picks at random when both are ready, so a closed connection could
+	// otherwise still take messages while its queue has room
+	if c.isClosed() {
+		return false
+	}
+	select {
+	case c.outgoing <- message:
+		return true
+	case <-c.closed:
+		return false
+	}
+}
+
+func (c *webextensionConn) close() {
+	c.closeOnce.Do(func() {
+		close(c.closed)
+		if c.ws != nil {
+			c.ws.Close()
+		}
+	})
+}
+
+// Everything the connection was given but never sent, in the order it was given. Only
+// for connections that have been started and closed, as it waits for the writer to stop.
+func (c *webextensionConn) unsent() []string {
+	<-c.writerStopped
+	var messages []string
+	if c.failed != "" {
+		messages = append(messages, c.failed)
+	}
+	for {
+		select {
+		case message := <-c.outgoing:
+			messages = append(messages, message)
+		default:
+			return messages
+		}
+	}
+}
+
+func (c *webextensionConn) isClosed() bool {
+	select {
+	case <-c.closed:
+		return true
+	default:
+		return false
 	}
-	stdinChannel <- message
 }
 
 // Listen to all messages coming from the webextension
-// TODO: It seems this *also* receives sent to the webextention!?
-func webSocketReader(ws *websocket.Conn) {
-	defer ws.Close()
+func (c *webextensionConn) read(onClose func()) {
+	defer onClose()
+	defer c.close()
 	for {
-		_, message, err := ws.ReadMessage()
-		handleWebextensionCommand(message)
+		messageType, message, err := c.ws.ReadMessage()
 		if err != nil {
-			if websocket.IsCloseError(err, websocket.CloseGoingAway) {
+			if websocket.IsCloseError(err, websocket.CloseGoingAway, websocket.CloseNormalClosure) {
 				slog.Info("Socket reader detected that the browser closed the websocket")
-				triggerSocketWriterClose()
-				return
+			} else if !c.isClosed() {
+				slog.Error("Socket reader detected that the connection unexpectedly dissapeared",
+					"error", err)
 			}
-			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway) {
-				slog.Error("Socket reader detected that the connection unexpectedly dissapeared")
-				triggerSocketWriterClose()
+			return
+		}
+		if messageType == websocket.BinaryMessage {
+			handleWebextensionBinaryMessage(message)
+			continue
+		}
+		handleWebextensionCommand(message)
+	}
+}
+
+// Send messages to the webextension. The writer stops as soon as the connection closes,
+// rather than when it next has something to send.
+func (c *webextensionConn) write() {
+	defer close(c.writerStopped)
+	for {
+		select {
+		case message := <-c.outgoing:
+			slog.Info("TTY sending", "message", message)
+			if err := c.ws.WriteMessage(websocket.TextMessage, []byte(message)); err != nil {
+				if errors.Is(err, websocket.ErrCloseSent) {
+					slog.Info("Socket writer detected that the browser closed the websocket")
+				} else {
+					slog.Error("Socket writer detected unexpected closure of websocket", "error", err)
+				}
+				c.failed = message
+				c.close()
 				return
 			}
-			Shutdown(err)
+		case <-c.closed:
+			return
 		}
 	}
 }
 
-func handleWebextensionCommand(message []byte) {
-	parts := strings.Split(string(message), ",")
-	command := parts[0]
+// The greetings are sent first, so that the webextension is set up before it's sent
+// anything else. Then whatever was kept from while the webextension was disconnected is
+// sent, before anyone else can send anything. Returns whether the webextension has
+// connected before.
+func (l *webextensionLink) connect(conn *webextensionConn, greetings ...string) bool {
+	l.Lock()
+	defer l.Unlock()
+	if l.conn != nil {
+		slog.Info("A new webextension connection replaced the existing one")
+		l.conn.close()
+		l.keepUnsent(l.conn)
+	}
+	l.conn = conn
+	isReconnection := l.hasConnected
+	l.hasConnected = true
+	conn.start(func() { l.disconnected(conn) })
+	for _, greeting := range greetings {
+		conn.send(greeting)
+	}
+	l.replay()
+	return isReconnection
+}
+
+func (l *webextensionLink) disconnected(conn *webextensionConn) {
+	l.Lock()
+	if l.conn != conn {
+		// Already replaced by a newer connection, which kept what this one didn't send
+		l.Unlock()
+		return
+	}
+	l.conn = nil
+	l.keepUnsent(conn)
+	l.Unlock()
+	slog.Info("Webextension disconnected, waiting for it to reconnect")
+	showConnectionStatus("Reconnecting to Firefox...")
+}
+
+func (l *webextensionLink) isConnected() bool {
+	l.Lock()
+	defer l.Unlock()
+	return l.conn != nil
+}
+
+// Messages are sent in the order they're given, including those that were kept from
+// while the webextension was disconnected
+func (l *webextensionLink) send(message string) {
+	l.Lock()
+	defer l.Unlock()
+	if l.conn != nil && l.conn.send(message) {
+		return
+	}
+	l.keep(message)
+}
+
+// Must be called with the link locked
+func (l *webextensionLink) keep(message string) {
+	l.pending = append(l.pending, message)
+	l.dropOldestPending()
+}
+
+// What a closed connection didn't get to send was given before anything that's been
+// kept since. Must be called with the link locked.
+func (l *webextensionLink) keepUnsent(conn *webextensionConn) {
+	l.pending = append(conn.unsent(), l.pending...)
+	l.dropOldestPending()
+}
+
+func (l *webextensionLink) dropOldestPending() {
+	if len(l.pending) <= maxPendingMessages {
+		return
+	}
+	dropped := len(l.pending) - maxPendingMessages
+	slog.Info("Too many messages for the disconnected webextension, dropping the oldest",
+		"count", dropped)
+	l.pending = l.pending[dropped:]
+}
+
+// Send everything that was kept from while the webextension was disconnected. Must be
+// called with the link locked.
+func (l *webextensionLink) replay() {
+	if len(l.pending) > 0 {
+		slog.Info("Sending messages from while the webextension was disconnected",
+			"count", len(l.pending))
+	}
+	pending := l.pending
+	l.pending = nil
+	for index, message := range pending {
+		if l.conn == nil || !l.conn.send(message) {
+			l.pending = append(l.pending, pending[index:]...)
+			return
+		}
+	}
+}
+
+func handleWebextensionCommand(raw []byte) {
+	message, err := decodeWebextensionMessage(raw)
+	if err != nil {
+		warnAboutUnknownMessage(raw)
+		return
+	}
+	switch message.Command {
+	case "/hello":
+		var hello helloPayload
+		if message.decodePayload(&hello) {
+			checkWebextensionVersion(hello)
+		}
+		return
+	case "/log":
+		var log logPayload
+		if message.decodePayload(&log) {
+			slog.Info("WEBEXT", "message", log.Message)
+		}
+		return
+	}
 	if viper.GetBool("http-server-mode") {
-		handleRawFrameTextCommands(parts)
+		handleRawFrameTextCommands(message)
 		return
 	}
-	switch command {
+	switch message.Command {
 	case "/frame_text":
-		parseJSONFrameText(strings.Join(parts[1:], ","))
+		parseJSONFrameText(string(message.Payload))
 		renderCurrentTabWindow()
 	case "/frame_pixels":
-		parseJSONFramePixels(strings.Join(parts[1:], ","))
+		parseJSONFramePixels(string(message.Payload))
 		renderCurrentTabWindow()
 	case "/tab_state":
-		parseJSONTabState(strings.Join(parts[1:], ","))
+		parseJSONTabState(string(message.Payload))
 		if CurrentTab != nil {
 			renderUI()
 		}
 	case "/screenshot":
-		saveScreenshot(parts[1])
+		var screenshot screenshotPayload
+		if message.decodePayload(&screenshot) {
+			saveScreenshot(screenshot.Data)
+		}
 	default:
-		slog.Info("WEBEXT", "message", string(message))
+		slog.Info("WEBEXT", "unhandled", message.Command)
 	}
 }
 
-func handleRawFrameTextCommands(parts []string) {
-	var incoming incomingRawText
-	command := parts[0]
-	if command == "/raw_text" {
-		jsonBytes := []byte(strings.Join(parts[1:], ","))
-		if err := json.Unmarshal(jsonBytes, &incoming); err != nil {
-			Shutdown(err)
-		}
-		if incoming.RequestID != "" {
-			slog.Info("Raw text for", "RequestID", incoming.RequestID)
-			rawTextRequests.store(incoming.RequestID, incoming.RawJSON)
-		} else {
-			slog.Info("Raw text but no associated request ID")
-		}
-	} else {
-		slog.Info("WEBEXT", "command", strings.Join(parts[0:], ","))
+// Binary messages are only ever frames
+func handleWebextensionBinaryMessage(message []byte) {
+	if viper.GetBool("http-server-mode") {
+		slog.Info("Ignoring binary frame in HTTP server mode")
+		return
+	}
+	if handleBinaryFrame(message) {
+		renderCurrentTabWindow()
 	}
 }
 
-// When the socket reader attempts to read from a closed websocket it quickly and
-// simply closes its associated Go routine. However the socket writer won't
-// automatically notice until it actually needs to send something. So we force that
-// by sending this NOOP text.
-// TODO: There's a potential race condition because new connections share the same
-//
-//	Go channel. So we need to setup a new channel for every connection.
-func triggerSocketWriterClose() {
-	stdinChannel <- "BROWSH CLIENT FORCING CLOSE OF WEBSOCKET WRITER"
-}
-
-// Send a message to the webextension
-func webSocketWriter(ws *websocket.Conn) {
-	var message string
-	defer ws.Close()
-	for {
-		message = <-stdinChannel
-		slog.Info("TTY sending", "message", message)
-		if err := ws.WriteMessage(websocket.TextMessage, []byte(message)); err != nil {
-			if errors.Is(err, websocket.ErrCloseSent) {
-				slog.Info("Socket writer detected that the browser closed the websocket")
-			} else {
-				slog.Error("Socket writer detected unexpected closure of websocket", "error", err)
-			}
+func handleRawFrameTextCommands(message webextensionMessage) {
+	switch message.Command {
+	case "/raw_text":
+		if message.CorrelationID == "" {
+			slog.Info("Raw text but no associated request ID")
 			return
 		}
+		slog.Info("Raw text for", "RequestID", message.CorrelationID)
+		if !rawTextRequests.resolve(message.CorrelationID, string(message.Payload)) {
+			slog.Info("Raw text for a request that is no longer waiting")
+		}
+	case "/raw_text_blocked":
+		// The page tried to load something on a private network, or to go somewhere its
+		// API key isn't allowed, most likely by redirecting there
+		if !rawTextRequests.reject(message.CorrelationID, rawTextBlockedError(message)) {
+			slog.Info("Blocked destination for a request that is no longer waiting")
+		}
+	default:
+		slog.Info("WEBEXT", "unhandled", message.Command)
 	}
 }
 
 func webSocketServer(w http.ResponseWriter, r *http.Request) {
 	slog.Info("Incoming web request from browser")
+	if !isWebsocketTokenValid(r) {
+		slog.Error("Refused a websocket connection without Browsh's token")
+		http.Error(w, "A valid token is required", http.StatusUnauthorized)
+		return
+	}
 	ws, err := upgrader.Upgrade(w, r, nil)
 	if err != nil {
 		Shutdown(err)
 	}
-	IsConnectedToWebExtension = true
-	go webSocketWriter(ws)
-	go webSocketReader(ws)
-	sendConfigToWebExtension()
+	conn := newWebextensionConn(ws)
+	if browserPool != nil {
+		browserPool.connect(conn)
+		return
+	}
+	isReconnection := webextension.connect(conn,
+		newHelloMessage().encode(), newConfigMessage().encode())
 	setDefaultFirefoxPreferences()
 	if !viper.GetBool("http-server-mode") {
 		sendTtySize()
 	}
+	if isReconnection {
+		slog.Info("Webextension reconnected")
+		return
+	}
 	// For some reason, using Firefox's CLI arg `--url https://google.com` doesn't consistently
 	// work. So we do it here instead.
 	validURL := viper.GetStringSlice("validURL")
 	if len(validURL) == 0 {
 		if !IsHTTPServerMode {
-			sendMessageToWebExtension("/new_tab," + viper.GetString("startup-url"))
+			sendCommandToWebExtension("/new_tab", newTabPayload{URL: viper.GetString("startup-url")})
 		}
 	} else {
 		for i := 0; i < len(validURL); i++ {
-			sendMessageToWebExtension("/new_tab," + validURL[i])
+			sendCommandToWebExtension("/new_tab", newTabPayload{URL: validURL[i]})
 		}
 	}
 }
 
-func sendConfigToWebExtension() {
-	configJSON, _ := json.Marshal(viper.AllSettings())
-	sendMessageToWebExtension("/config," + string(configJSON))
+func newConfigMessage() webextensionMessage {
+	return webextensionMessage{
+		Version: protocolVersion,
+		Command: "/config",
+		Payload: json.RawMessage(getWebExtensionConfig()),
+	}
+}
+
+func getWebExtensionConfig() string {
+	settings := viper.AllSettings()
+	// The webextension has no use for secrets, and it logs its config when debugging
+	if httpServer, ok := settings["http-server"].(map[string]interface{}); ok {
+		delete(httpServer, "api-keys")
+	}
+	configJSON, _ := json.Marshal(settings)
+	return string(configJSON)
+}
+
+func rawTextBlockedError(message webextensionMessage) error {
+	var blocked rawTextBlockedPayload
+	if len(message.Payload) > 0 && message.decodePayload(&blocked) &&
+		blocked.Reason == rawTextBlockedAllowedDomains {
+		return errDisallowedByAPIKey
+	}
+	return errDisallowedDestination
 }
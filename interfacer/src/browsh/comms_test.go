@@ -0,0 +1,129 @@
+package browsh
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/websocket"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+func TestComms(t *testing.T) {
+	RegisterFailHandler(Fail)
+}
+
+var _ = Describe("Webextension comms", func() {
+	var link *webextensionLink
+	var server *httptest.Server
+	var accepted chan *websocket.Conn
+
+	// Returns Browsh's side of a new connection, and the webextension's side
+	dial := func() (*webextensionConn, *websocket.Conn) {
+		url := "ws" + strings.TrimPrefix(server.URL, "http")
+		client, _, err := websocket.DefaultDialer.Dial(url, nil)
+		Expect(err).ToNot(HaveOccurred())
+		return newWebextensionConn(<-accepted), client
+	}
+
+	receive := func(client *websocket.Conn) string {
+		_, message, err := client.ReadMessage()
+		Expect(err).ToNot(HaveOccurred())
+		return string(message)
+	}
+
+	BeforeEach(func() {
+		link = &webextensionLink{}
+		accepted = make(chan *websocket.Conn, 1)
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ws, _ := upgrader.Upgrade(w, r, nil)
+			accepted <- ws
+		}))
+	})
+
+	AfterEach(func() {
+		// The webextension's side is closed by each spec, wait for Browsh to notice
+		Eventually(link.isConnected).Should(BeFalse())
+		server.Close()
+	})
+
+	It("should send messages to a connected webextension", func() {
+		conn, client := dial()
+		defer client.Close()
+		Expect(link.connect(conn)).To(BeFalse())
+		Expect(link.isConnected()).To(BeTrue())
+		link.send("/tty_size,80,24")
+		Expect(receive(client)).To(Equal("/tty_size,80,24"))
+	})
+
+	It("should keep messages from before the webextension connects", func() {
+		link.send("/new_tab,https://www.brow.sh")
+		link.send("/stdin,{}")
+		conn, client := dial()
+		defer client.Close()
+		link.connect(conn)
+		Expect(receive(client)).To(Equal("/new_tab,https://www.brow.sh"))
+		Expect(receive(client)).To(Equal("/stdin,{}"))
+	})
+
+	It("should send what it kept once the webextension reconnects", func() {
+		conn, client := dial()
+		link.connect(conn)
+		client.Close()
+		Eventually(link.isConnected).Should(BeFalse())
+		link.send("/stdin,{}")
+		conn, client = dial()
+		defer client.Close()
+		Expect(link.connect(conn, "/config,{}")).To(BeTrue())
+		link.send("/tty_size,80,24")
+		Expect(receive(client)).To(Equal("/config,{}"))
+		Expect(receive(client)).To(Equal("/stdin,{}"))
+		Expect(receive(client)).To(Equal("/tty_size,80,24"))
+	})
+
+	It("should keep what a closed connection didn't get to send", func() {
+		conn := newWebextensionConn(nil)
+		conn.failed = "/stdin,first"
+		conn.outgoing <- "/stdin,second"
+		close(conn.writerStopped)
+		link.conn = conn
+		link.send("/stdin,third")
+		conn.close()
+		link.disconnected(conn)
+		Expect(link.pending).To(Equal([]string{"/stdin,first", "/stdin,second", "/stdin,third"}))
+	})
+
+	It("should keep a message that failed to be written", func() {
+		conn, client := dial()
+		defer client.Close()
+		link.connect(conn)
+		conn.ws.Close()
+		link.send("/stdin,{}")
+		Eventually(link.isConnected).Should(BeFalse())
+		Expect(link.pending).To(Equal([]string{"/stdin,{}"}))
+	})
+
+	It("should only keep so many messages while disconnected", func() {
+		for i := 0; i < maxPendingMessages+1; i++ {
+			link.send("/stdin,{}")
+		}
+		link.send("/stdin,last")
+		Expect(link.pending).To(HaveLen(maxPendingMessages))
+		Expect(link.pending[maxPendingMessages-1]).To(Equal("/stdin,last"))
+	})
+
+	It("should give every connection its own queue", func() {
+		old, oldClient := dial()
+		defer oldClient.Close()
+		link.connect(old)
+		conn, client := dial()
+		defer client.Close()
+		link.connect(conn)
+		Eventually(old.closed).Should(BeClosed())
+		link.send("/stdin,{}")
+		Expect(old.send("/stdin,stale")).To(BeFalse())
+		Expect(receive(client)).To(Equal("/stdin,{}"))
+	})
+})
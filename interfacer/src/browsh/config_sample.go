@@ -16,12 +16,23 @@ mobile_user_agent = "Mozilla/5.0 (Android 7.0; Mobile; rv:54.0) Gecko/58.0 Firef
 
 [browsh] # Browsh internals
 websocket-port = 3334
+# The address that the websocket which Firefox connects to listens on. Whatever can
+# connect to it can control Firefox, so by default only local processes can.
+websocket-bind = "127.0.0.1"
+# Send frames from Firefox as compact binary, rather than JSON, which is much quicker
+# to parse. Only turn this off if frames aren't showing properly.
+binary-frames = true
 
 # Possibly better handling of overlapping text in web pages. If a page seems to have
 # text that shouldn't be visible, if it should be behind another element for example,
 # then this experimental feature should help. It can also be toggled in-browser with F6.
 use_experimental_text_visibility = false
 
+# The maximum width, in characters, of the text in reader mode. Reader mode strips a
+# page down to just its main article. It can be toggled in-browser with ALT+r, or
+# requested from the HTTP server with the "X-Browsh-Raw-Mode: READER" header.
+reader_width = 72
+
 # Custom CSS to apply to all loaded tabs, eg;
 #   custom_css = """
 #   body {
@@ -62,6 +73,19 @@ small_pixel_frame_rate = 250
 port = 4333
 bind = "0.0.0.0"
 
+# Serve HTTPS with this certificate and key, both PEM encoded. For trying out HTTPS
+# locally, "tls-self-signed" makes a new self-signed certificate whenever Browsh starts.
+# When serving HTTPS, plain HTTP requests to "http-redirect-port", if it isn't 0, are
+# redirected to HTTPS.
+tls-cert = ""
+tls-key = ""
+tls-self-signed = false
+http-redirect-port = 0
+
+# Redirect requests to HTTPS when a proxy or load balancer in front of Browsh says,
+# with the "X-Forwarded-Proto" header, that it received them over plain HTTP
+https-redirect = false
+
 # The time to wait in milliseconds after the DOM is ready before
 # trying to parse and render the page's text. Too soon and text risks not being
 # parsed, too long and you wait unecessarily.
@@ -70,6 +94,27 @@ render_delay = 100
 # The length of time in seconds to wait before aborting the page load
 timeout = 30
 
+# The most pages that Firefox renders at the same time, 0 for no limit. Any more wait
+# their turn in a queue, and when the queue is full, or a page has waited for longer
+# than "queue-timeout" seconds, clients get a 503 response and are asked to retry.
+max-concurrency = 10
+queue-size = 100
+queue-timeout = 10
+
+# When Browsh is asked to quit, it stops accepting new requests and waits up to this
+# many seconds for the requests it's already handling to finish
+shutdown-grace-period = 30
+
+# The number of Firefoxes to render pages with. Each one has its own temporary profile,
+# and its own Marionette port, counting up from "browser-pool-marionette-port". Pages
+# are either shared out in turn with "round-robin", or given to whichever Firefox is
+# rendering the fewest pages with "least-busy". Firefoxes can be restarted after they've
+# rendered "browser-pool-recycle-after" pages, 0 to never restart them.
+browser-pool-size = 1
+browser-pool-marionette-port = 2830
+browser-pool-dispatch = "least-busy"
+browser-pool-recycle-after = 0
+
 # The dimensions of a char-based window onto a webpage.
 # The columns are ultimately the width of the final text. Whereas the rows
 # represent the height of the original web page made visible to the original
@@ -82,8 +127,35 @@ rows = 30
 # pages.
 jpeg_compression = 0.9
 
+# Whether PLAIN mode marks links with numbered references, like "Browsh[1]", and lists
+# their URLs at the end of the page.
+link_footnotes = false
+
+# Clients can override the above render options for a single request, either with
+# headers like "X-Browsh-Columns: 40" or with query parameters like "?browsh_columns=40".
+# These are the largest values they are allowed to ask for.
+max-columns = 400
+max-rows = 200
+max-render-delay = 5000
+max-timeout = 60
+
+# Cache rendered pages, so that repeat requests for the same URL, mode and render
+# options don't need Firefox. Either "memory", "disk" (kept in Browsh's config folder)
+# or "" to turn caching off. Cached pages can be removed early with a POST to
+# /api/v1/admin/cache/purge.
+cache = ""
+# How long, in seconds, a rendered page is cached for
+cache-ttl = 600
+# The most space, in megabytes, that cached pages can take up
+cache-max-size = 100
+
 # Rate limit. For syntax, see: https://github.com/ulule/limiter
 rate-limit = "100000000-M"
+# Where requests are counted for rate limiting. "memory" only counts the requests to
+# this instance, so when running several instances behind a load balancer use "redis",
+# which works with anything that speaks the Redis protocol.
+rate-limit-store = "memory"
+rate-limit-redis-url = "redis://localhost:6379/0"
 
 # Blocking is useful if the HTTP server is made public. All values are evaluated as
 # regular expressions.
@@ -93,7 +165,62 @@ blocked-domains = [
 blocked-user-agents = [
 ]
 
+# Stop pages from being rendered from private networks, such as "localhost" or a cloud
+# provider's metadata service at 169.254.169.254. Hosts are resolved before a page is
+# loaded, and again for every request the page makes, including redirects. Turn this on
+# if the HTTP server is made public, and add any intranet hosts that it should still be
+# able to render to "allowed-destinations".
+block-private-destinations = false
+blocked-destination-ranges = [
+  "0.0.0.0/8",
+  "10.0.0.0/8",
+  "100.64.0.0/10",
+  "127.0.0.0/8",
+  "169.254.0.0/16",
+  "172.16.0.0/12",
+  "192.168.0.0/16",
+  "::/128",
+  "::1/128",
+  "fc00::/7",
+  "fe80::/10",
+]
+# Hosts or IP ranges that can be rendered even though they're private, eg;
+# ["intranet.example.com", "10.1.0.0/16"]
+allowed-destinations = [
+]
+
+# Serve Prometheus metrics at /metrics. They're served on the same address as pages are,
+# and aren't rate limited, so only turn them on where /metrics can't be reached from the
+# public internet, or with "require-api-key" on, so that scrapers need an API key too.
+metrics = false
+
+# Write a JSON line for every request to this file, "" to turn the access log off. The
+# access log is separate from the debug log. It's rotated once it reaches
+# "access-log-max-size" megabytes, keeping "access-log-max-backups" old logs for
+# "access-log-max-age" days, 0 to keep them all.
+access-log = ""
+access-log-max-size = 100
+access-log-max-backups = 5
+access-log-max-age = 0
+
 # HTML snippets to show at top and bottom of final page.
 header = ""
 footer = ""
+
+# Only allow requests that have a valid API key
+require-api-key = false
+# A file of more API keys, in the same format as below but without the "http-server."
+# prefix. It's reloaded whenever it changes, so keys can be added or revoked without a
+# restart.
+api-keys-file = ""
+
+# API keys, that clients send in the "X-Browsh-API-Key" header or as a bearer token.
+# A key can have its own rate limit, which replaces the per-IP "rate-limit" above. It
+# can also be limited to rendering certain domains and their subdomains. Only admin
+# keys can use the /api/v1/admin/ routes, like purging the cache, eg;
+#   [[http-server.api-keys]]
+#   key = "a-long-random-string"
+#   rate-limit = "1000-M"
+#   allowed-domains = ["example.com", "intranet.local"]
+#   admin = false
 `
@@ -0,0 +1,135 @@
+package browsh
+
+import (
+	"context"
+	"log/slog"
+	"net"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/go-errors/errors"
+	"github.com/spf13/viper"
+)
+
+var errDisallowedDestination = errors.New("Browsh won't render pages on private networks")
+
+// The same checks as the webextension's `_getURLfromUserInput()`, which decides whether
+// what's in the URL bar is a URL or a search
+var (
+	straddledDotPattern = regexp.MustCompile(`^[^\s]+\.[^\s]+`)
+	urlishPattern       = regexp.MustCompile(`//\w+(\.\w+)*(:[0-9]+)?/?(/[.\w]*)*$`)
+)
+
+// Whether the HTTP server is allowed to render a URL. Public HTTP servers shouldn't be
+// able to reach anything that only the machine running them can reach, such as
+// `localhost` or a cloud provider's metadata service. The URL's host is resolved here,
+// and then again by the webextension for every request a page makes, including
+// redirects, as DNS can give a different answer by the time Firefox asks.
+func checkDestination(ctx context.Context, urlForBrowsh string) error {
+	if !viper.GetBool("http-server.block-private-destinations") {
+		return nil
+	}
+	destination, isURL := parseDestination(urlForBrowsh)
+	if !isURL {
+		// Searches go to the configured search engine
+		return nil
+	}
+	if destination == nil {
+		return errDisallowedDestination
+	}
+	host := destination.Hostname()
+	if isAllowedDestinationHost(host) {
+		return nil
+	}
+	addresses, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		// Firefox wouldn't be able to load it either, unless it's one of the other ways of
+		// writing IP addresses that Firefox understands, like `http://2130706433/`
+		slog.Info("Couldn't resolve destination", "host", host, "error", err)
+		return errDisallowedDestination
+	}
+	for _, address := range addresses {
+		if isPrivateDestination(address.IP) {
+			slog.Info("Blocked private destination", "url", urlForBrowsh, "ip", address.IP)
+			return errDisallowedDestination
+		}
+	}
+	return nil
+}
+
+// Returns false when the webextension would treat the input as a search rather than a
+// URL. A nil URL means that it is a URL, just not one that could ever be allowed, like
+// a `file://` URL.
+func parseDestination(urlForBrowsh string) (*url.URL, bool) {
+	urlForBrowsh = strings.TrimSpace(urlForBrowsh)
+	if !straddledDotPattern.MatchString(urlForBrowsh) && !urlishPattern.MatchString(urlForBrowsh) {
+		return nil, false
+	}
+	if !strings.HasPrefix(urlForBrowsh, "http") {
+		urlForBrowsh = "http://" + urlForBrowsh
+	}
+	parsed, err := url.Parse(urlForBrowsh)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return nil, true
+	}
+	return parsed, true
+}
+
+func isPrivateDestination(ip net.IP) bool {
+	for _, network := range parseDestinationRanges("http-server.blocked-destination-ranges") {
+		if network.Contains(ip) {
+			return !isAllowedDestinationIP(ip)
+		}
+	}
+	return false
+}
+
+// `allowed-destinations` can have both host names and IP ranges
+func isAllowedDestinationHost(host string) bool {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	for _, allowed := range viper.GetStringSlice("http-server.allowed-destinations") {
+		if strings.ToLower(allowed) == host {
+			return true
+		}
+	}
+	if ip := net.ParseIP(host); ip != nil {
+		return isAllowedDestinationIP(ip)
+	}
+	return false
+}
+
+func isAllowedDestinationIP(ip net.IP) bool {
+	for _, network := range parseDestinationRanges("http-server.allowed-destinations") {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// Single IPs are treated as ranges of just that IP. Anything else, like a host name in
+// `allowed-destinations`, is skipped.
+func parseDestinationRanges(key string) []*net.IPNet {
+	var networks []*net.IPNet
+	for _, value := range viper.GetStringSlice(key) {
+		if !strings.Contains(value, "/") {
+			ip := net.ParseIP(value)
+			if ip == nil {
+				continue
+			}
+			bits := 8 * len(ip)
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 32
+			}
+			networks = append(networks, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		if _, network, err := net.ParseCIDR(value); err == nil {
+			networks = append(networks, network)
+		} else {
+			slog.Error("Invalid IP range", "config", key, "range", value)
+		}
+	}
+	return networks
+}
@@ -0,0 +1,96 @@
+package browsh
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/spf13/viper"
+)
+
+func TestDestination(t *testing.T) {
+	RegisterFailHandler(Fail)
+}
+
+var _ = Describe("Destination policy", func() {
+	check := func(urlForBrowsh string) error {
+		return checkDestination(context.Background(), urlForBrowsh)
+	}
+
+	BeforeEach(func() {
+		viper.Set("http-server.block-private-destinations", true)
+		viper.Set("http-server.blocked-destination-ranges", []string{
+			"10.0.0.0/8", "127.0.0.0/8", "169.254.0.0/16", "::1/128", "fc00::/7",
+		})
+	})
+
+	AfterEach(func() {
+		viper.Set("http-server.block-private-destinations", false)
+		viper.Set("http-server.blocked-destination-ranges", nil)
+		viper.Set("http-server.allowed-destinations", nil)
+	})
+
+	It("should block private IP addresses", func() {
+		Expect(check("http://169.254.169.254/latest/meta-data/")).To(MatchError(errDisallowedDestination))
+		Expect(check("https://10.1.2.3:8080")).To(MatchError(errDisallowedDestination))
+		Expect(check("http://[::1]/index.html")).To(MatchError(errDisallowedDestination))
+		Expect(check("http://[::ffff:127.0.0.1]/")).To(MatchError(errDisallowedDestination))
+	})
+
+	It("should block hosts that resolve to private IP addresses", func() {
+		Expect(check("localhost:4444/page.html")).To(MatchError(errDisallowedDestination))
+		Expect(check("http://user@127.0.0.1/")).To(MatchError(errDisallowedDestination))
+	})
+
+	It("should allow public IP addresses", func() {
+		Expect(check("http://93.184.216.34/")).To(Succeed())
+		Expect(check("https://[2606:2800:220:1::]/index.html")).To(Succeed())
+	})
+
+	It("should block URLs that Firefox wouldn't load over HTTP", func() {
+		Expect(check("file:///etc/passwd")).To(MatchError(errDisallowedDestination))
+	})
+
+	It("should leave searches, including ones that look a bit like URLs, to the search engine", func() {
+		Expect(check("localhost")).To(Succeed())
+		Expect(check("http://[::1]/")).To(Succeed())
+	})
+
+	It("should allow hosts and ranges in the allow list", func() {
+		viper.Set("http-server.allowed-destinations", []string{"localhost", "10.1.0.0/16"})
+		Expect(check("http://localhost/index.html")).To(Succeed())
+		Expect(check("http://10.1.2.3/")).To(Succeed())
+		Expect(check("http://10.2.0.1/")).To(MatchError(errDisallowedDestination))
+	})
+
+	It("should allow anything when turned off", func() {
+		viper.Set("http-server.block-private-destinations", false)
+		Expect(check("http://169.254.169.254/")).To(Succeed())
+	})
+
+	It("should block cached renders of destinations that are now blocked", func() {
+		renderCache = newMemoryRenderStore(time.Minute, 1024)
+		defer func() { renderCache = nil }()
+		key := renderCacheKey("http://10.1.2.3/", "PLAIN", rawTextOptions{})
+		renderCache.set(key, newCachedRender("http://10.1.2.3/", "PLAIN", "{}", 1))
+		_, _, err := renderPage(context.Background(), "http://10.1.2.3/", "PLAIN", rawTextOptions{})
+		Expect(err).To(MatchError(errDisallowedDestination))
+	})
+
+	It("should tell waiting renders that their destination was blocked", func() {
+		request := rawTextRequests.add(nil)
+		go handleRawFrameTextCommands(newCorrelatedMessage("/raw_text_blocked", request.ID, nil))
+		_, err := waitForRawText(context.Background(), request, 1)
+		Expect(err).To(MatchError(errDisallowedDestination))
+	})
+
+	It("should tell waiting renders that their API key isn't allowed where the page went", func() {
+		request := rawTextRequests.add(nil)
+		go handleRawFrameTextCommands(newCorrelatedMessage("/raw_text_blocked", request.ID,
+			rawTextBlockedPayload{Reason: rawTextBlockedAllowedDomains}))
+		_, err := waitForRawText(context.Background(), request, 1)
+		Expect(err).To(MatchError(errDisallowedByAPIKey))
+	})
+})
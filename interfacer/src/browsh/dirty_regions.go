@@ -0,0 +1,163 @@
+package browsh
+
+// A rectangle of cells, from its top left up to, but not including, its bottom right
+type cellRegion struct {
+	left   int
+	top    int
+	right  int
+	bottom int
+}
+
+// Which part of which tab is on the screen. When nothing about it has changed since the
+// last render, then only what's changed in the frame needs to be drawn again.
+type tabWindowView struct {
+	tab     *tab
+	xScroll int
+	yScroll int
+	width   int
+	height  int
+}
+
+// What the screen showed after the last render, nil when it needs to be drawn afresh
+var renderedView *tabWindowView
+
+// For whenever the screen no longer shows what was last rendered, like after it's
+// cleared, or when cells are drawn differently
+func invalidateTabWindow() {
+	renderedView = nil
+}
+
+func (r cellRegion) isEmpty() bool {
+	return r.left >= r.right || r.top >= r.bottom
+}
+
+func (r cellRegion) translate(x, y int) cellRegion {
+	return cellRegion{left: r.left + x, top: r.top + y, right: r.right + x, bottom: r.bottom + y}
+}
+
+func (r cellRegion) intersect(other cellRegion) cellRegion {
+	return cellRegion{
+		left:   max(r.left, other.left),
+		top:    max(r.top, other.top),
+		right:  min(r.right, other.right),
+		bottom: min(r.bottom, other.bottom),
+	}
+}
+
+// Frames are built from a different goroutine than scrolling renders them in
+func (f *frame) markDirty(region cellRegion) {
+	f.dirtyLock.Lock()
+	defer f.dirtyLock.Unlock()
+	f.dirty = append(f.dirty, region)
+}
+
+func (f *frame) markAllDirty() {
+	f.dirtyLock.Lock()
+	defer f.dirtyLock.Unlock()
+	f.isAllDirty = true
+	f.dirty = nil
+}
+
+func (f *frame) takeDirtyRegions() ([]cellRegion, bool) {
+	f.dirtyLock.Lock()
+	defer f.dirtyLock.Unlock()
+	regions, isAllDirty := f.dirty, f.isAllDirty
+	f.dirty = nil
+	f.isAllDirty = false
+	return regions, isAllDirty
+}
+
+// How many rows the window's content has moved up since the last render, for a scroll
+// that only moved the view vertically, and by less than the window's height. Returns
+// false when the window needs to be drawn afresh.
+func scrolledRows(view tabWindowView) (int, bool) {
+	if renderedView == nil {
+		return 0, false
+	}
+	unscrolled := view
+	unscrolled.yScroll = renderedView.yScroll
+	if unscrolled != *renderedView {
+		return 0, false
+	}
+	rows := view.yScroll - renderedView.yScroll
+	if rows >= view.height || -rows >= view.height {
+		return 0, false
+	}
+	return rows, true
+}
+
+// The regions of the tab's window to draw, in window coordinates, and how many rows
+// what's already on the screen should be shifted up by first, see `shiftTabWindow()`.
+// Only the rows that a vertical scroll brings into view need drawing, horizontal scrolls
+// draw the whole window.
+func regionsToRender(t *tab, width, height int) ([]cellRegion, int) {
+	f := &t.frame
+	window := cellRegion{right: width, bottom: height}
+	view := tabWindowView{
+		tab:     t,
+		xScroll: f.xScroll,
+		yScroll: f.yScroll,
+		width:   width,
+		height:  height,
+	}
+	dirty, isAllDirty := f.takeDirtyRegions()
+	scrolled, isScrollable := scrolledRows(view)
+	renderedView = &view
+	if !isScrollable || isAllDirty {
+		return []cellRegion{window}, 0
+	}
+	// Input boxes are drawn over the frame on every render, and their cursors are drawn
+	// by reversing what's already on the screen
+	for _, box := range f.inputBoxes {
+		dirty = append(dirty, cellRegion{
+			left:   box.X,
+			top:    box.Y,
+			right:  box.X + box.Width,
+			bottom: box.Y + box.Height,
+		})
+	}
+	var regions []cellRegion
+	if scrolled > 0 {
+		regions = append(regions, cellRegion{right: width, top: height - scrolled, bottom: height})
+	} else if scrolled < 0 {
+		regions = append(regions, cellRegion{right: width, bottom: -scrolled})
+	}
+	for _, region := range dirty {
+		region = region.translate(-f.xScroll, -f.yScroll).intersect(window)
+		if !region.isEmpty() {
+			regions = append(regions, region)
+		}
+	}
+	// The status message and call to support are drawn over the bottom of the window,
+	// and are shorter or gone on some renders. When the window is shifted they're
+	// shifted with it, over the page.
+	overlays := cellRegion{left: 0, top: height - 2, right: width, bottom: height}
+	if scrolled > 0 {
+		regions = append(regions, overlays.translate(0, -scrolled).intersect(window))
+	}
+	return append(regions, overlays.intersect(window)), scrolled
+}
+
+// Moves what's already drawn in the tab's window up by some rows, or down for negative
+// rows, so that a vertical scroll only draws the rows that it brings into view. Tcell
+// doesn't give access to the terminal's own scroll regions, so this shifts its buffer.
+func shiftTabWindow(rows, width, height int) {
+	if rows == 0 {
+		return
+	}
+	copyRow := func(from, to int) {
+		for x := 0; x < width; x++ {
+			mainc, combc, style, _ := screen.GetContent(x, from+uiHeight)
+			screen.SetContent(x, to+uiHeight, mainc, combc, style)
+		}
+	}
+	if rows > 0 {
+		for y := 0; y+rows < height; y++ {
+			copyRow(y+rows, y)
+		}
+	} else {
+		for y := height - 1; y+rows >= 0; y-- {
+			copyRow(y+rows, y)
+		}
+	}
+}
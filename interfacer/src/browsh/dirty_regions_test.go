@@ -0,0 +1,159 @@
+package browsh
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/gdamore/tcell"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/spf13/viper"
+)
+
+func TestDirtyRegions(t *testing.T) {
+	RegisterFailHandler(Fail)
+}
+
+// A copy of what's on the screen, as the simulation only gives access to its own buffer
+func testScreenContents(simulation tcell.SimulationScreen) []string {
+	cells, _, _ := simulation.GetContents()
+	contents := make([]string, len(cells))
+	for i, c := range cells {
+		contents[i] = fmt.Sprintf("%s %d", string(c.Runes), c.Style)
+	}
+	return contents
+}
+
+var _ = Describe("Dirty regions", func() {
+	const width, height = 10, 6
+	overlays := cellRegion{left: 0, top: height - 2, right: width, bottom: height}
+	window := cellRegion{right: width, bottom: height}
+
+	regions := func(t *tab) []cellRegion {
+		regions, _ := regionsToRender(t, width, height)
+		return regions
+	}
+
+	BeforeEach(func() {
+		newTab(1)
+		invalidateTabWindow()
+		parseJSONFrameText(frameJSONText)
+		regionsToRender(Tabs[1], width, height)
+	})
+
+	It("should draw the whole window the first time", func() {
+		invalidateTabWindow()
+		Expect(regions(Tabs[1])).To(Equal([]cellRegion{window}))
+	})
+
+	It("should only draw what a new frame changed", func() {
+		parseJSONFramePixels(frameJSONPixels)
+		Expect(regions(Tabs[1])).To(Equal([]cellRegion{
+			{left: 0, top: 0, right: 2, bottom: 2},
+			overlays,
+		}))
+		Expect(regions(Tabs[1])).To(Equal([]cellRegion{overlays}))
+	})
+
+	It("should only draw what's in the window", func() {
+		Tabs[1].frame.markDirty(cellRegion{left: 8, top: 2, right: 20, bottom: 20})
+		Expect(regions(Tabs[1])).To(Equal([]cellRegion{
+			{left: 8, top: 2, right: 10, bottom: 6},
+			overlays,
+		}))
+	})
+
+	It("should only draw the rows a one-row scroll brings into view", func() {
+		Tabs[1].frame.yScroll = 1
+		regions, scrolled := regionsToRender(Tabs[1], width, height)
+		Expect(scrolled).To(Equal(1))
+		Expect(regions).To(Equal([]cellRegion{
+			{left: 0, top: height - 1, right: width, bottom: height},
+			{left: 0, top: height - 3, right: width, bottom: height - 1},
+			overlays,
+		}))
+	})
+
+	It("should only draw the rows scrolling back up brings into view", func() {
+		Tabs[1].frame.yScroll = 2
+		regionsToRender(Tabs[1], width, height)
+		Tabs[1].frame.yScroll = 1
+		regions, scrolled := regionsToRender(Tabs[1], width, height)
+		Expect(scrolled).To(Equal(-1))
+		Expect(regions).To(Equal([]cellRegion{
+			{left: 0, top: 0, right: width, bottom: 1},
+			overlays,
+		}))
+	})
+
+	It("should draw the whole window after scrolling further than it", func() {
+		Tabs[1].frame.yScroll = height
+		Expect(regions(Tabs[1])).To(Equal([]cellRegion{window}))
+	})
+
+	It("should draw the whole window after scrolling sideways", func() {
+		Tabs[1].frame.xScroll = 1
+		Expect(regions(Tabs[1])).To(Equal([]cellRegion{window}))
+	})
+
+	It("should draw the whole window for a different tab", func() {
+		newTab(2)
+		Expect(regions(Tabs[2])).To(Equal([]cellRegion{window}))
+	})
+
+	It("should draw input boxes on every render", func() {
+		Tabs[1].frame.inputBoxes["box"] = &inputBox{X: 1, Y: 1, Width: 3, Height: 1}
+		Expect(regions(Tabs[1])).To(Equal([]cellRegion{
+			{left: 1, top: 1, right: 4, bottom: 2},
+			overlays,
+		}))
+	})
+
+	It("should leave the screen the same as drawing everything would", func() {
+		simulation := tcell.NewSimulationScreen("UTF-8")
+		Expect(simulation.Init()).To(Succeed())
+		defer simulation.Fini()
+		// Taller than the page, so that some rows are neither changed nor under the overlays
+		simulation.SetSize(2, 6+uiHeight)
+		screen = simulation
+		defer func() { screen = nil }()
+		previousTab := CurrentTab
+		CurrentTab = Tabs[1]
+		defer func() { CurrentTab = previousTab }()
+		viper.Set("browsh_supporter", "I have shown my support for Browsh")
+		defer viper.Set("browsh_supporter", "")
+
+		renderCurrentTabWindow()
+		parseJSONFramePixels(frameJSONPixels)
+		renderCurrentTabWindow()
+		partial := testScreenContents(simulation)
+		invalidateTabWindow()
+		renderCurrentTabWindow()
+		Expect(partial).To(Equal(testScreenContents(simulation)))
+	})
+
+	It("should leave the screen the same after a scroll as drawing everything would", func() {
+		simulation := tcell.NewSimulationScreen("UTF-8")
+		Expect(simulation.Init()).To(Succeed())
+		defer simulation.Fini()
+		// Tall enough for some rows to only be right if they were shifted
+		simulation.SetSize(2, 6+uiHeight)
+		screen = simulation
+		defer func() { screen = nil }()
+		previousTab := CurrentTab
+		CurrentTab = Tabs[1]
+		defer func() { CurrentTab = previousTab }()
+		viper.Set("browsh_supporter", "I have shown my support for Browsh")
+		defer viper.Set("browsh_supporter", "")
+		parseJSONFramePixels(frameJSONPixels)
+
+		for _, yScroll := range []int{0, 1, 0} {
+			Tabs[1].frame.yScroll = yScroll
+			renderCurrentTabWindow()
+			partial := testScreenContents(simulation)
+			invalidateTabWindow()
+			renderCurrentTabWindow()
+			Expect(partial).To(Equal(testScreenContents(simulation)))
+		}
+	})
+})
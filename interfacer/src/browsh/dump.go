@@ -0,0 +1,304 @@
+package browsh
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-errors/errors"
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+)
+
+// Exit codes for dump mode, so that scripts can tell why a render didn't succeed. A batch
+// exits with the code that all of its failures share, or with `dumpExitError` when they
+// failed for different reasons. Any other internal error exits with 1 via `Shutdown()`.
+const (
+	dumpExitSuccess = 0
+	dumpExitError   = 1
+	dumpExitUsage   = 2
+	dumpExitTimeout = 3
+)
+
+var (
+	_ = pflag.Bool("dump", false, "Render the given URL as text to STDOUT and exit")
+	_ = pflag.String("dump-mode", "PLAIN", "Raw text mode used by --dump: PLAIN, HTML, DOM, MARKDOWN, READER or LINKS")
+	_ = pflag.String("dump-file", "", "File of URLs, one per line, to render with --dump. Use '-' for STDIN")
+	_ = pflag.Int("dump-concurrency", 4, "How many tabs --dump renders in parallel")
+	_ = pflag.String("dump-output-dir", "", "Write each --dump result to its own file in this folder, rather than as JSON lines to STDOUT")
+
+	isFirefoxStartedForDump = false
+	unsafeFilenameChars     = regexp.MustCompile(`[^a-zA-Z0-9.-]+`)
+)
+
+// The outcome of rendering a single URL. In batch mode these are written to STDOUT as
+// JSON lines.
+type dumpResult struct {
+	URL              string `json:"url"`
+	Status           string `json:"status"`
+	TotalDuration    int    `json:"total_duration"`
+	PageloadDuration int    `json:"page_load_duration"`
+	ParsingDuration  int    `json:"parsing_duration"`
+	Text             string `json:"body"`
+	index            int
+}
+
+// DumpStart renders URLs in exactly the same way as the HTTP server does, writes the
+// results to STDOUT and then exits. It saves scripts from having to boot the HTTP
+// server just to make requests to it.
+//
+// A single URL is written out as-is. Multiple URLs, either as arguments or from
+// `--dump-file`, are rendered concurrently in separate tabs.
+func DumpStart() {
+	urls, isBatch := getDumpURLs()
+	mode := getDumpMode()
+	startDumpBrowser()
+	if !isBatch {
+		result := renderForDump(0, urls[0], mode)
+		if result.Status != "ok" {
+			dumpExit(dumpFailure(result))
+		}
+		fmt.Fprint(os.Stdout, result.Text)
+		dumpExit(dumpExitSuccess, "")
+	}
+	failures := dumpBatch(urls, mode)
+	if len(failures) > 0 {
+		dumpExit(dumpBatchFailure(failures, len(urls)))
+	}
+	dumpExit(dumpExitSuccess, "")
+}
+
+// The exit code and message for when a single URL couldn't be rendered
+func dumpFailure(result dumpResult) (int, string) {
+	switch result.Status {
+	case "invalid_url":
+		return dumpExitUsage, "Invalid URL: " + result.URL
+	case "timeout":
+		return dumpExitTimeout, rawTextTimeoutMessage(rawTextOptions{}.timeout())
+	}
+	return dumpExitError, errNoBrowserConnected.Error()
+}
+
+func dumpBatchFailure(failures []dumpResult, total int) (int, string) {
+	message := fmt.Sprintf("%d of %d URLs failed to render", len(failures), total)
+	code, _ := dumpFailure(failures[0])
+	for _, failure := range failures[1:] {
+		if other, _ := dumpFailure(failure); other != code {
+			return dumpExitError, message
+		}
+	}
+	return code, message
+}
+
+func startDumpBrowser() {
+	// The webextension only builds raw text when it believes it's serving HTTP requests
+	IsHTTPServerMode = true
+	viper.Set("http-server-mode", true)
+	// Dumping is only ever for whoever is running Browsh, so it can reach whatever they can
+	viper.Set("http-server.block-private-destinations", false)
+	// Don't let the usual startup logic open the URLs in interactive tabs as well
+	viper.Set("validURL", []string{})
+	StartFirefox()
+	isFirefoxStartedForDump = true
+	go startWebSocketServer()
+	if !waitForWebExtensionConnection(30 * time.Second) {
+		dumpExit(dumpExitTimeout, "Firefox's webextension didn't connect within 30 seconds")
+	}
+}
+
+func getDumpURLs() ([]string, bool) {
+	var urls []string
+	source := viper.GetString("dump-file")
+	if source != "" {
+		urls = readDumpURLsFrom(source)
+	}
+	urls = append(urls, viper.GetStringSlice("validURL")...)
+	if len(urls) == 0 {
+		dumpExit(dumpExitUsage, "--dump needs a URL, eg; browsh --dump https://www.brow.sh")
+	}
+	return urls, source != "" || len(urls) > 1
+}
+
+func getDumpMode() string {
+	mode := strings.ToUpper(viper.GetString("dump-mode"))
+	if !isValidRawTextMode(mode) {
+		dumpExit(dumpExitUsage, "Unknown --dump-mode: "+mode)
+	}
+	return mode
+}
+
+func readDumpURLsFrom(source string) []string {
+	var input io.Reader
+	if source == "-" {
+		input = os.Stdin
+	} else {
+		file, err := os.Open(source)
+		if err != nil {
+			dumpExit(dumpExitUsage, err.Error())
+		}
+		defer file.Close()
+		input = file
+	}
+	urls, err := parseDumpURLs(input)
+	if err != nil {
+		dumpExit(dumpExitUsage, err.Error())
+	}
+	return urls
+}
+
+// One URL per line. Blank lines and lines starting with '#' are ignored.
+func parseDumpURLs(input io.Reader) ([]string, error) {
+	var urls []string
+	scanner := bufio.NewScanner(input)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		urls = append(urls, line)
+	}
+	return urls, scanner.Err()
+}
+
+// Render every URL, spreading them over a fixed number of concurrent tabs. Returns the
+// results of the URLs that failed.
+func dumpBatch(urls []string, mode string) []dumpResult {
+	var workers sync.WaitGroup
+	var failures []dumpResult
+	jobs := make(chan int)
+	results := make(chan dumpResult)
+	concurrency := viper.GetInt("dump-concurrency")
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	for i := 0; i < concurrency; i++ {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			for index := range jobs {
+				results <- renderForDump(index, urls[index], mode)
+			}
+		}()
+	}
+	go func() {
+		for index := range urls {
+			jobs <- index
+		}
+		close(jobs)
+		workers.Wait()
+		close(results)
+	}()
+	for result := range results {
+		if result.Status != "ok" {
+			failures = append(failures, result)
+		}
+		writeDumpResult(result, mode)
+	}
+	return failures
+}
+
+func renderForDump(index int, urlForBrowsh, mode string) dumpResult {
+	result := dumpResult{URL: urlForBrowsh, index: index}
+	if _, err := url.ParseRequestURI(urlForBrowsh); err != nil {
+		result.Status = "invalid_url"
+		return result
+	}
+	slog.Info("Dumping", "url", urlForBrowsh, "mode", mode)
+	options := rawTextOptions{}
+	request, err := dispatchRawTextRequest(urlForBrowsh, mode, options)
+	if err != nil {
+		result.Status = "unavailable"
+		return result
+	}
+	rawTextRequestResponse, err := waitForRawText(context.Background(), request, options.timeout())
+	result.TotalDuration = request.totalDuration()
+	if errors.Is(err, errNoBrowserConnected) {
+		result.Status = "unavailable"
+		return result
+	}
+	if err != nil {
+		result.Status = "timeout"
+		return result
+	}
+	response := unpackResponse(rawTextRequestResponse)
+	result.Status = "ok"
+	result.PageloadDuration = response.PageloadDuration
+	result.ParsingDuration = response.ParsingDuration
+	result.Text = rawTextBody(response, mode)
+	return result
+}
+
+func writeDumpResult(result dumpResult, mode string) {
+	outputDir := viper.GetString("dump-output-dir")
+	if outputDir == "" {
+		line, _ := json.Marshal(result)
+		fmt.Fprintln(os.Stdout, string(line))
+		return
+	}
+	if result.Status != "ok" {
+		fmt.Fprintf(os.Stderr, "%s: %s\n", result.URL, result.Status)
+		return
+	}
+	if err := os.MkdirAll(outputDir, os.ModePerm); err != nil {
+		dumpExit(dumpExitUsage, err.Error())
+	}
+	path := filepath.Join(outputDir, dumpFilename(result.index, result.URL, mode))
+	if err := os.WriteFile(path, []byte(result.Text), 0o644); err != nil {
+		dumpExit(dumpExitError, err.Error())
+	}
+}
+
+// The index keeps filenames unique and in the same order as the original list of URLs
+func dumpFilename(index int, urlForBrowsh, mode string) string {
+	extension := ".html"
+	switch mode {
+	case "PLAIN", "READER":
+		extension = ".txt"
+	case "MARKDOWN":
+		extension = ".md"
+	case "LINKS":
+		extension = ".json"
+	}
+	name := strings.TrimPrefix(urlForBrowsh, "https://")
+	name = strings.TrimPrefix(name, "http://")
+	name = strings.Trim(unsafeFilenameChars.ReplaceAllString(name, "_"), "_")
+	if len(name) > 100 {
+		name = name[:100]
+	}
+	return fmt.Sprintf("%04d-%s%s", index, name, extension)
+}
+
+func waitForWebExtensionConnection(maxTime time.Duration) bool {
+	start := time.Now()
+	for time.Since(start) < maxTime {
+		if IsConnectedToWebExtension() {
+			return true
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	return false
+}
+
+// Unlike `Shutdown()` this reports problems on STDERR, as there's no TTY UI in dump mode
+// and the debug log is usually off.
+func dumpExit(code int, message string) {
+	if message != "" {
+		fmt.Fprintln(os.Stderr, message)
+		slog.Error("Dump mode exiting", "code", code, "message", message)
+	}
+	if isFirefoxStartedForDump && !viper.GetBool("firefox.use-existing") {
+		quitFirefox()
+	}
+	unshareWebsocketToken()
+	os.Exit(code)
+}
@@ -0,0 +1,68 @@
+package browsh
+
+import (
+	"strings"
+	"testing"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+func TestDump(t *testing.T) {
+	RegisterFailHandler(Fail)
+}
+
+var _ = Describe("Dump mode", func() {
+	Describe("Reading URLs", func() {
+		It("should skip blank lines and comments", func() {
+			input := strings.NewReader(
+				"https://www.brow.sh\n\n# A comment\n  https://example.com  \n")
+			urls, err := parseDumpURLs(input)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(urls).To(Equal([]string{"https://www.brow.sh", "https://example.com"}))
+		})
+	})
+
+	Describe("Failures", func() {
+		It("should exit with a usage error that names an invalid URL", func() {
+			code, message := dumpFailure(renderForDump(0, "not a URL", "PLAIN"))
+			Expect(code).To(Equal(dumpExitUsage))
+			Expect(message).To(Equal("Invalid URL: not a URL"))
+		})
+		It("should only report timeouts as timeouts", func() {
+			code, message := dumpFailure(dumpResult{URL: "https://example.com", Status: "timeout"})
+			Expect(code).To(Equal(dumpExitTimeout))
+			Expect(message).To(ContainSubstring("timeout"))
+		})
+		It("should exit a batch with the code its failures share", func() {
+			code, message := dumpBatchFailure([]dumpResult{
+				{URL: "not a URL", Status: "invalid_url"},
+				{URL: "also not a URL", Status: "invalid_url"},
+			}, 3)
+			Expect(code).To(Equal(dumpExitUsage))
+			Expect(message).To(Equal("2 of 3 URLs failed to render"))
+		})
+		It("should exit a batch with a general error for different failures", func() {
+			code, _ := dumpBatchFailure([]dumpResult{
+				{URL: "https://example.com", Status: "timeout"},
+				{URL: "https://example.org", Status: "unavailable"},
+			}, 2)
+			Expect(code).To(Equal(dumpExitError))
+		})
+	})
+
+	Describe("Output filenames", func() {
+		It("should make a filesystem-safe name from the URL", func() {
+			name := dumpFilename(3, "https://example.com/path?q=hey", "PLAIN")
+			Expect(name).To(Equal("0003-example.com_path_q_hey.txt"))
+		})
+		It("should use an HTML extension for HTML modes", func() {
+			name := dumpFilename(12, "http://example.com/", "DOM")
+			Expect(name).To(Equal("0012-example.com.html"))
+		})
+		It("should use a Markdown extension for MARKDOWN mode", func() {
+			name := dumpFilename(1, "https://example.com/", "MARKDOWN")
+			Expect(name).To(Equal("0001-example.com.md"))
+		})
+	})
+})
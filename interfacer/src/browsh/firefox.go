@@ -5,6 +5,7 @@ import (
 	"embed"
 	"encoding/json"
 	"fmt"
+	"io"
 	"io/fs"
 	"log/slog"
 	"net"
@@ -15,6 +16,8 @@ import (
 	"regexp"
 	"runtime"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 
@@ -26,10 +29,17 @@ import (
 //go:embed browsh.xpi
 var browshXpi embed.FS
 
+// The port that Firefox's Marionette service listens on, unless it's told otherwise
+const defaultMarionettePort = 2828
+
 var (
 	marionette     net.Conn
 	ffCommandCount = 0
-	defaultFFPrefs = map[string]string{
+	// Whether the Firefox that Browsh started is still running
+	isFirefoxRunning atomic.Bool
+	// Marionette connections that Firefox has closed, usually because it quit
+	closedMarionettes sync.Map
+	defaultFFPrefs    = map[string]string{
 		"startup.homepage_welcome_url.additional": "''",
 		"devtools.errorconsole.enabled":           "true",
 		"devtools.chrome.enabled":                 "true",
@@ -86,6 +96,8 @@ func startHeadlessFirefox() {
 	if err := firefoxProcess.Start(); err != nil {
 		Shutdown(err)
 	}
+	isFirefoxRunning.Store(true)
+	defer isFirefoxRunning.Store(false)
 	in := bufio.NewScanner(stdout)
 	for in.Scan() {
 		slog.Info("FF-CONSOLE", "stdout", in.Text())
@@ -160,7 +172,7 @@ func versionOrdinal(version string) string {
 // extension.
 func startWERFirefox() {
 	slog.Info("Attempting to start headless Firefox with `web-ext`")
-	if IsConnectedToWebExtension {
+	if IsConnectedToWebExtension() {
 		Shutdown(errors.New("There appears to already be an existing Web Extension connection"))
 	}
 	checkIfFirefoxIsAlreadyRunning()
@@ -180,6 +192,8 @@ func startWERFirefox() {
 	if err := firefoxProcess.Start(); err != nil {
 		Shutdown(err)
 	}
+	isFirefoxRunning.Store(true)
+	defer isFirefoxRunning.Store(false)
 	in := bufio.NewScanner(stdout)
 	for in.Scan() {
 		if strings.Contains(in.Text(), "Connected to the remote Firefox debugger") {
@@ -205,36 +219,40 @@ func startWERFirefox() {
 // I've used Marionette here, simply because it was easier to reverse engineer
 // from the Python Marionette package.
 func firefoxMarionette() {
-	var (
-		err  error
-		conn net.Conn
-	)
-	connected := false
-	slog.Info("Attempting to connect to Firefox Marionette")
+	conn, err := connectToMarionette(defaultMarionettePort)
+	if err != nil {
+		Shutdown(err)
+	}
+	marionette = conn
+	go readMarionette(marionette)
+	sendFirefoxCommand("WebDriver:NewSession", map[string]interface{}{})
+}
+
+// Firefox takes a moment to start listening, so keep trying for a while
+func connectToMarionette(port int) (net.Conn, error) {
+	slog.Info("Attempting to connect to Firefox Marionette", "port", port)
+	address := fmt.Sprintf("127.0.0.1:%d", port)
 	start := time.Now()
 	for time.Since(start) < 30*time.Second {
-		conn, err = net.Dial("tcp", "127.0.0.1:2828")
-		if err != nil {
-			if !strings.Contains(err.Error(), "refused") {
-				Shutdown(err)
-			} else {
-				time.Sleep(10 * time.Millisecond)
-				continue
-			}
-		} else {
-			connected = true
-			break
+		conn, err := net.Dial("tcp", address)
+		if err == nil {
+			return conn, nil
 		}
+		if !strings.Contains(err.Error(), "refused") {
+			return nil, err
+		}
+		time.Sleep(10 * time.Millisecond)
 	}
-	if !connected {
-		Shutdown(errors.New("Failed to connect to Firefox's Marionette within 30 seconds"))
-	}
-	marionette = conn
-	go readMarionette()
-	sendFirefoxCommand("WebDriver:NewSession", map[string]interface{}{})
+	return nil, errors.New("Failed to connect to Firefox's Marionette within 30 seconds")
 }
 
 func installWebextension() {
+	args := map[string]interface{}{"path": writeWebextensionXpi()}
+	sendFirefoxCommand("Addon:Install", args)
+}
+
+// Firefox can only install the webextension from a file
+func writeWebextensionXpi() string {
 	data, err := browshXpi.ReadFile("browsh.xpi")
 	if err != nil {
 		Shutdown(err)
@@ -243,8 +261,7 @@ func installWebextension() {
 	if err := os.WriteFile(path, []byte(data), 0644); err != nil {
 		Shutdown(err)
 	}
-	args := map[string]interface{}{"path": path}
-	sendFirefoxCommand("Addon:Install", args)
+	return path
 }
 
 // Set a Firefox preference as you would in `about:config`
@@ -264,24 +281,39 @@ func setFFPreference(key string, value string) {
 
 // Consume output from Marionette, we don't do anything with it. It"s just
 // useful to have it in the logs.
-func readMarionette() {
+func readMarionette(conn net.Conn) {
 	buffer := make([]byte, 4096)
-	count, err := marionette.Read(buffer)
+	count, err := conn.Read(buffer)
 	if err != nil {
+		if errors.Is(err, io.EOF) || errors.Is(err, net.ErrClosed) {
+			closedMarionettes.Store(conn, true)
+		}
 		slog.Error("Error reading from Marionette connection", "error", err)
 		return
 	}
 	slog.Info("FF-MRNT", "buffer", string(buffer[:count]))
 }
 
+func isMarionetteConnected(conn net.Conn) bool {
+	if conn == nil {
+		return false
+	}
+	_, isClosed := closedMarionettes.Load(conn)
+	return !isClosed
+}
+
 func sendFirefoxCommand(command string, args map[string]interface{}) {
+	writeMarionetteCommand(marionette, ffCommandCount, command, args)
+	ffCommandCount++
+}
+
+func writeMarionetteCommand(conn net.Conn, id int, command string, args map[string]interface{}) {
 	slog.Info("Sending command to Firefox Marionette", "command", command, "args", args)
-	fullCommand := []interface{}{0, ffCommandCount, command, args}
+	fullCommand := []interface{}{0, id, command, args}
 	marshalled, _ := json.Marshal(fullCommand)
 	message := fmt.Sprintf("%d:%s", len(marshalled), marshalled)
-	fmt.Fprintf(marionette, "%s", message)
-	ffCommandCount++
-	go readMarionette()
+	fmt.Fprintf(conn, "%s", message)
+	go readMarionette(conn)
 }
 
 func setDefaultFirefoxPreferences() {
@@ -299,7 +331,7 @@ func beginTimeLimit() {
 	warningLimit := time.Duration(*timeLimit - warningLength)
 	time.Sleep(warningLimit * time.Second)
 	message := fmt.Sprintf("Browsh will close in %d seconds...", warningLength)
-	sendMessageToWebExtension("/status," + message)
+	sendCommandToWebExtension("/status", statusPayload{Message: message})
 	time.Sleep(time.Duration(warningLength) * time.Second)
 	quitBrowsh()
 }
@@ -310,18 +342,29 @@ func setupFirefox() {
 	if *timeLimit > 0 {
 		go beginTimeLimit()
 	}
+	quitOnSignals()
+	firefoxMarionette()
+	installWebextension()
+}
+
+// The HTTP server handles signals itself, so that it can finish its renders first
+func quitOnSignals() {
+	if isServerHandlingSignals {
+		return
+	}
 	sigs := make(chan os.Signal, 1)
 	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
 	go func() {
 		<-sigs
 		quitBrowsh()
 	}()
-
-	firefoxMarionette()
-	installWebextension()
 }
 
 func StartFirefox() {
+	shareWebsocketToken()
+	if IsHTTPServerMode && startFirefoxPool() {
+		return
+	}
 	if !viper.GetBool("firefox.use-existing") {
 		writeString(0, 16, "Waiting for Firefox to connect...", tcell.StyleDefault)
 		if IsTesting {
@@ -338,5 +381,9 @@ func StartFirefox() {
 }
 
 func quitFirefox() {
+	if browserPool != nil {
+		browserPool.quit()
+		return
+	}
 	sendFirefoxCommand("Marionette:Quit", map[string]interface{}{})
 }
@@ -0,0 +1,458 @@
+package browsh
+
+import (
+	"bufio"
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-errors/errors"
+	"github.com/spf13/viper"
+)
+
+// HTTP server mode can render pages with more than one Firefox, nil when there's only
+// the one
+var browserPool *firefoxPool
+
+// How long to wait before trying to start a browser again when it fails to restart
+const browserPoolRetryDelay = 30 * time.Second
+
+var errNoBrowserConnected = errors.New("No browsers are available to render pages")
+
+// Each browser in the pool is a separate Firefox process, with its own temporary
+// profile, Marionette port and websocket connection. Renders are shared between them,
+// and a browser can be restarted after a number of renders, which stops long-running
+// Firefoxes from slowly eating memory.
+type firefoxPool struct {
+	sync.Mutex
+	instances    []*firefoxInstance
+	firefoxPath  string
+	dispatch     string
+	recycleAfter int
+	// For round-robin dispatch
+	nextIndex int
+	// Browsers are started one at a time, so that the next webextension to connect is
+	// known to belong to the browser that was just started.
+	starting   sync.Mutex
+	connecting *firefoxInstance
+	// Replaced in tests, so that recycling doesn't need a real Firefox
+	restart func(instance *firefoxInstance)
+}
+
+// Apart from `id` and `marionettePort`, everything here belongs to the instance's
+// current Firefox process, and is reset whenever it's restarted.
+type firefoxInstance struct {
+	pool           *firefoxPool
+	id             int
+	marionettePort int
+	profile        string
+	process        *exec.Cmd
+	exited         chan struct{}
+	marionette     net.Conn
+	commandCount   int
+	// For talking to the webextension, nil until it connects
+	conn *webextensionConn
+	// Closed once the webextension connects
+	connected chan struct{}
+	// The number of renders in progress, and finished since Firefox started
+	active  int
+	renders int
+	// Whether the browser is waiting for its renders to finish so it can restart
+	isDraining  bool
+	isRecycling bool
+}
+
+// Returns false when Browsh should start a single Firefox as usual
+func startFirefoxPool() bool {
+	size := viper.GetInt("http-server.browser-pool-size")
+	if size <= 1 {
+		return false
+	}
+	if IsTesting || viper.GetBool("firefox.use-existing") {
+		slog.Info("Not starting a browser pool, because Firefox isn't started by Browsh")
+		return false
+	}
+	dispatch := viper.GetString("http-server.browser-pool-dispatch")
+	if dispatch != "round-robin" && dispatch != "least-busy" {
+		Shutdown(errors.New("Unknown http-server.browser-pool-dispatch: " + dispatch))
+	}
+	browserPool = newFirefoxPool(
+		size,
+		viper.GetInt("http-server.browser-pool-marionette-port"),
+		dispatch,
+		viper.GetInt("http-server.browser-pool-recycle-after"),
+	)
+	checkIfFirefoxIsAlreadyRunning()
+	browserPool.firefoxPath = ensureFirefoxBinary()
+	ensureFirefoxVersion(browserPool.firefoxPath)
+	quitOnSignals()
+	// The websocket server that the webextensions connect to is started afterwards
+	go browserPool.startAll()
+	return true
+}
+
+func newFirefoxPool(size, firstPort int, dispatch string, recycleAfter int) *firefoxPool {
+	pool := &firefoxPool{
+		dispatch:     dispatch,
+		recycleAfter: recycleAfter,
+	}
+	pool.restart = pool.recycle
+	for i := 0; i < size; i++ {
+		pool.instances = append(pool.instances, &firefoxInstance{
+			pool:           pool,
+			id:             i,
+			marionettePort: firstPort + i,
+		})
+	}
+	return pool
+}
+
+func (p *firefoxPool) startAll() {
+	for _, instance := range p.instances {
+		if err := p.start(instance); err != nil {
+			Shutdown(err)
+		}
+	}
+	slog.Info("All browsers in the pool are ready", "size", len(p.instances))
+}
+
+func (p *firefoxPool) start(instance *firefoxInstance) error {
+	p.starting.Lock()
+	defer p.starting.Unlock()
+	slog.Info("Starting pooled Firefox", "browser", instance.id, "port", instance.marionettePort)
+	if err := instance.startProcess(); err != nil {
+		return err
+	}
+	conn, err := connectToMarionette(instance.marionettePort)
+	if err != nil {
+		instance.kill()
+		return err
+	}
+	p.Lock()
+	instance.marionette = conn
+	instance.connected = make(chan struct{})
+	p.connecting = instance
+	p.Unlock()
+	go readMarionette(conn)
+	instance.sendCommand("WebDriver:NewSession", map[string]interface{}{})
+	instance.sendCommand("Addon:Install", map[string]interface{}{"path": writeWebextensionXpi()})
+	defer func() {
+		p.Lock()
+		p.connecting = nil
+		p.Unlock()
+	}()
+	select {
+	case <-instance.connected:
+		return nil
+	case <-time.After(30 * time.Second):
+		instance.kill()
+		return errors.Errorf("Firefox %d's webextension didn't connect within 30 seconds", instance.id)
+	}
+}
+
+// Hand a new webextension connection to the browser that's being started
+func (p *firefoxPool) connect(conn *webextensionConn) {
+	p.Lock()
+	instance := p.connecting
+	if instance == nil || instance.conn != nil {
+		p.Unlock()
+		slog.Error("Unexpected webextension connection to the browser pool")
+		conn.close()
+		return
+	}
+	instance.conn = conn
+	close(instance.connected)
+	p.Unlock()
+	slog.Info("Webextension connected", "browser", instance.id)
+	conn.start(func() {
+		slog.Info("Pooled webextension disconnected", "browser", instance.id)
+		p.disconnected(instance, conn)
+	})
+	instance.send(newHelloMessage())
+	instance.send(newConfigMessage())
+}
+
+// Pick a browser for a new render. Browsers that are about to restart are only used
+// when there's nothing else. Without a pool there's nothing to pick, and renders go to
+// the single Firefox.
+func (p *firefoxPool) acquire() (*firefoxInstance, error) {
+	if p == nil {
+		return nil, nil
+	}
+	p.Lock()
+	defer p.Unlock()
+	instance := p.choose(false)
+	if instance == nil {
+		instance = p.choose(true)
+	}
+	if instance == nil {
+		slog.Error("No browsers in the pool are connected")
+		return nil, errNoBrowserConnected
+	}
+	instance.active++
+	return instance, nil
+}
+
+func (p *firefoxPool) choose(includeDraining bool) *firefoxInstance {
+	var chosen *firefoxInstance
+	for offset := range p.instances {
+		index := (p.nextIndex + offset) % len(p.instances)
+		instance := p.instances[index]
+		if instance.conn == nil || instance.isRecycling {
+			continue
+		}
+		if instance.isDraining && !includeDraining {
+			continue
+		}
+		if p.dispatch == "round-robin" {
+			p.nextIndex = index + 1
+			return instance
+		}
+		if chosen == nil || instance.active < chosen.active {
+			chosen = instance
+		}
+	}
+	return chosen
+}
+
+// Called once a render has finished, whether or not it succeeded
+func (p *firefoxPool) release(instance *firefoxInstance) {
+	if p == nil || instance == nil {
+		return
+	}
+	p.Lock()
+	defer p.Unlock()
+	instance.active--
+	instance.renders++
+	if p.recycleAfter > 0 && instance.renders >= p.recycleAfter {
+		instance.isDraining = true
+	}
+	p.maybeRecycle(instance)
+}
+
+func (p *firefoxPool) maybeRecycle(instance *firefoxInstance) {
+	if !instance.isDraining || instance.active > 0 || instance.isRecycling {
+		return
+	}
+	instance.isRecycling = true
+	go p.restart(instance)
+}
+
+// Replace a browser's Firefox with a fresh one
+func (p *firefoxPool) recycle(instance *firefoxInstance) {
+	slog.Info("Recycling pooled Firefox", "browser", instance.id)
+	instance.quit()
+	p.Lock()
+	if instance.marionette != nil {
+		instance.marionette.Close()
+	}
+	instance.marionette = nil
+	instance.commandCount = 0
+	if instance.conn != nil {
+		instance.conn.close()
+	}
+	instance.conn = nil
+	instance.renders = 0
+	p.Unlock()
+	err := p.start(instance)
+	p.Lock()
+	defer p.Unlock()
+	instance.isRecycling = false
+	if err != nil {
+		slog.Error("Couldn't restart pooled Firefox", "browser", instance.id, "error", err)
+		time.AfterFunc(browserPoolRetryDelay, func() {
+			p.Lock()
+			defer p.Unlock()
+			p.maybeRecycle(instance)
+		})
+		return
+	}
+	instance.isDraining = false
+}
+
+// When Firefox crashes, or quits because it's being recycled
+func (p *firefoxPool) disconnected(instance *firefoxInstance, conn *webextensionConn) {
+	p.Lock()
+	if instance.conn != conn {
+		// The browser has already been restarted
+		p.Unlock()
+		return
+	}
+	instance.conn = nil
+	instance.isDraining = true
+	p.maybeRecycle(instance)
+	p.Unlock()
+	// Nothing will answer the renders that the browser was given
+	rawTextRequests.rejectBrowser(instance, errNoBrowserConnected)
+}
+
+func (p *firefoxPool) quit() {
+	for _, instance := range p.instances {
+		instance.quit()
+	}
+}
+
+func (p *firefoxPool) health() []browserHealth {
+	p.Lock()
+	defer p.Unlock()
+	var health []browserHealth
+	for _, instance := range p.instances {
+		health = append(health, browserHealth{
+			ID:                    instance.id,
+			FirefoxRunning:        instance.isRunning(),
+			MarionetteConnected:   isMarionetteConnected(instance.marionette),
+			WebExtensionConnected: instance.conn != nil,
+		})
+	}
+	return health
+}
+
+// Whether the single Firefox's webextension is connected, or any pooled one's
+func IsConnectedToWebExtension() bool {
+	return connectedBrowsers() > 0
+}
+
+// The number of browsers that can be given pages to render
+func connectedBrowsers() int {
+	if browserPool == nil {
+		if webextension.isConnected() {
+			return 1
+		}
+		return 0
+	}
+	browserPool.Lock()
+	defer browserPool.Unlock()
+	connected := 0
+	for _, instance := range browserPool.instances {
+		if instance.conn != nil {
+			connected++
+		}
+	}
+	return connected
+}
+
+// Must be called with the pool locked
+func (i *firefoxInstance) isRunning() bool {
+	if i.exited == nil {
+		return false
+	}
+	select {
+	case <-i.exited:
+		return false
+	default:
+		return true
+	}
+}
+
+func (i *firefoxInstance) startProcess() error {
+	profile, err := os.MkdirTemp("", fmt.Sprintf("browsh-firefox-%d-", i.id))
+	if err != nil {
+		return err
+	}
+	if err := writeFirefoxUserPrefs(profile, i.marionettePort); err != nil {
+		return err
+	}
+	args := []string{"--marionette", "--no-remote", "--profile", profile}
+	if !viper.GetBool("firefox.with-gui") {
+		args = append(args, "--headless")
+	}
+	process := exec.Command(i.pool.firefoxPath, args...)
+	stdout, err := process.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	if err := process.Start(); err != nil {
+		return err
+	}
+	exited := make(chan struct{})
+	i.pool.Lock()
+	i.profile = profile
+	i.process = process
+	i.exited = exited
+	i.pool.Unlock()
+	go func() {
+		in := bufio.NewScanner(stdout)
+		for in.Scan() {
+			slog.Info("FF-CONSOLE", "browser", i.id, "stdout", in.Text())
+		}
+		process.Wait()
+		os.RemoveAll(profile)
+		close(exited)
+	}()
+	return nil
+}
+
+// The pool's profiles are new for every process, so rather than setting preferences
+// over Marionette once Firefox has started, they're written to the profile's `user.js`.
+func writeFirefoxUserPrefs(profile string, marionettePort int) error {
+	prefs := fmt.Sprintf("user_pref(\"marionette.port\", %d);\n", marionettePort)
+	for key, value := range defaultFFPrefs {
+		prefs += fmt.Sprintf("user_pref(\"%s\", %s);\n", key, value)
+	}
+	for _, pref := range viper.GetStringSlice("firefox.preferences") {
+		parts := strings.SplitN(pref, "=", 2)
+		if len(parts) == 2 {
+			prefs += fmt.Sprintf("user_pref(\"%s\", %s);\n", parts[0], parts[1])
+		}
+	}
+	return os.WriteFile(filepath.Join(profile, "user.js"), []byte(prefs), 0o600)
+}
+
+func (i *firefoxInstance) sendCommand(command string, args map[string]interface{}) {
+	i.pool.Lock()
+	conn := i.marionette
+	id := i.commandCount
+	i.commandCount++
+	i.pool.Unlock()
+	if conn == nil {
+		return
+	}
+	writeMarionetteCommand(conn, id, command, args)
+}
+
+// Ask Firefox to quit, and make sure that it does
+func (i *firefoxInstance) quit() {
+	i.sendCommand("Marionette:Quit", map[string]interface{}{})
+	i.pool.Lock()
+	exited := i.exited
+	i.pool.Unlock()
+	if exited == nil {
+		return
+	}
+	select {
+	case <-exited:
+	case <-time.After(10 * time.Second):
+		i.kill()
+		<-exited
+	}
+}
+
+func (i *firefoxInstance) kill() {
+	i.pool.Lock()
+	process := i.process
+	i.pool.Unlock()
+	if process != nil && process.Process != nil {
+		process.Process.Kill()
+	}
+}
+
+// Messages to a pooled webextension are dropped when it's not connected, as its renders
+// will have been given up on by the time its Firefox is restarted
+func (i *firefoxInstance) send(message webextensionMessage) {
+	i.pool.Lock()
+	conn := i.conn
+	i.pool.Unlock()
+	if conn == nil {
+		slog.Info("Webextension not connected. Message not sent", "browser", i.id, "command", message.Command)
+		return
+	}
+	if !conn.send(message.encode()) {
+		slog.Info("Webextension disconnected. Message not sent", "browser", i.id, "command", message.Command)
+	}
+}
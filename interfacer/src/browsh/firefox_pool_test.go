@@ -0,0 +1,157 @@
+package browsh
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+func TestFirefoxPool(t *testing.T) {
+	RegisterFailHandler(Fail)
+}
+
+var _ = Describe("Firefox pool", func() {
+	var pool *firefoxPool
+	var restarted chan int
+
+	// Pretend that each browser's webextension has connected
+	connectAll := func() {
+		for _, instance := range pool.instances {
+			instance.conn = newWebextensionConn(nil)
+		}
+	}
+
+	BeforeEach(func() {
+		restarted = make(chan int, 10)
+		pool = newFirefoxPool(3, 2830, "least-busy", 0)
+		pool.restart = func(instance *firefoxInstance) {
+			restarted <- instance.id
+		}
+		connectAll()
+	})
+
+	It("should give each browser its own Marionette port", func() {
+		Expect(pool.instances[0].marionettePort).To(Equal(2830))
+		Expect(pool.instances[2].marionettePort).To(Equal(2832))
+	})
+
+	acquire := func() *firefoxInstance {
+		instance, err := pool.acquire()
+		Expect(err).ToNot(HaveOccurred())
+		return instance
+	}
+
+	It("should give renders to the least busy browser", func() {
+		pool.instances[0].active = 2
+		pool.instances[1].active = 1
+		pool.instances[2].active = 3
+		Expect(acquire().id).To(Equal(1))
+		Expect(pool.instances[1].active).To(Equal(2))
+	})
+
+	It("should share out renders in turn with round-robin", func() {
+		pool.dispatch = "round-robin"
+		Expect(acquire().id).To(Equal(0))
+		Expect(acquire().id).To(Equal(1))
+		Expect(acquire().id).To(Equal(2))
+		Expect(acquire().id).To(Equal(0))
+	})
+
+	It("should skip browsers that aren't connected", func() {
+		pool.instances[0].conn = nil
+		pool.dispatch = "round-robin"
+		Expect(acquire().id).To(Equal(1))
+	})
+
+	It("should not render with anything when no browsers are connected", func() {
+		for _, instance := range pool.instances {
+			instance.conn = nil
+		}
+		_, err := pool.acquire()
+		Expect(err).To(MatchError(errNoBrowserConnected))
+	})
+
+	It("should fail renders straight away when no browsers are connected", func() {
+		for _, instance := range pool.instances {
+			instance.conn = nil
+		}
+		browserPool = pool
+		defer func() { browserPool = nil }()
+		_, _, err := renderPage(context.Background(), "https://www.brow.sh", "PLAIN", rawTextOptions{})
+		Expect(err).To(MatchError(errNoBrowserConnected))
+		Expect(rawTextRequests.internal).To(BeEmpty())
+	})
+
+	It("should recycle browsers once they've rendered enough pages", func() {
+		pool.recycleAfter = 2
+		instance := pool.instances[0]
+		instance.active = 2
+		pool.release(instance)
+		Expect(instance.isDraining).To(BeFalse())
+		pool.release(instance)
+		Expect(instance.isDraining).To(BeTrue())
+		Eventually(restarted).Should(Receive(Equal(0)))
+	})
+
+	It("should wait for a browser's renders to finish before recycling it", func() {
+		pool.recycleAfter = 1
+		instance := pool.instances[0]
+		instance.active = 2
+		pool.release(instance)
+		Expect(instance.isDraining).To(BeTrue())
+		Expect(acquire().id).ToNot(Equal(0))
+		Consistently(restarted).ShouldNot(Receive())
+		pool.release(instance)
+		Eventually(restarted).Should(Receive(Equal(0)))
+	})
+
+	It("should restart browsers that disconnect", func() {
+		instance := pool.instances[1]
+		pool.disconnected(instance, instance.conn)
+		Expect(instance.conn).To(BeNil())
+		Eventually(restarted).Should(Receive(Equal(1)))
+	})
+
+	It("should fail the renders of a browser that disconnects straight away", func() {
+		instance := pool.instances[1]
+		request := rawTextRequests.add(instance)
+		other := rawTextRequests.add(pool.instances[2])
+		defer rawTextRequests.remove(other.ID)
+		pool.disconnected(instance, instance.conn)
+		_, err := waitForRawText(context.Background(), request, 5)
+		Expect(err).To(MatchError(errNoBrowserConnected))
+		Expect(rawTextRequests.internal).ToNot(HaveKey(request.ID))
+		Expect(rawTextRequests.internal).To(HaveKey(other.ID))
+	})
+
+	It("should only be connected while a pooled browser is", func() {
+		browserPool = pool
+		defer func() { browserPool = nil }()
+		Expect(IsConnectedToWebExtension()).To(BeTrue())
+		for _, instance := range pool.instances {
+			pool.disconnected(instance, instance.conn)
+		}
+		Expect(connectedBrowsers()).To(Equal(0))
+		Expect(IsConnectedToWebExtension()).To(BeFalse())
+	})
+
+	It("should only send messages to the chosen browser", func() {
+		message := newCorrelatedMessage("/raw_text_request", "1", outgoingRawTextRequest{})
+		pool.instances[2].send(message)
+		Expect(pool.instances[2].conn.outgoing).To(Receive(Equal(message.encode())))
+		Expect(pool.instances[0].conn.outgoing).ToNot(Receive())
+	})
+
+	It("should write each profile's preferences", func() {
+		profile, _ := os.MkdirTemp("", "browsh-profile")
+		defer os.RemoveAll(profile)
+		Expect(writeFirefoxUserPrefs(profile, 2831)).To(Succeed())
+		prefs, _ := os.ReadFile(filepath.Join(profile, "user.js"))
+		Expect(string(prefs)).To(ContainSubstring(`user_pref("marionette.port", 2831);`))
+		Expect(string(prefs)).To(ContainSubstring(`user_pref("devtools.chrome.enabled", true);`))
+	})
+})
@@ -3,6 +3,9 @@
 package browsh
 
 import (
+	"os"
+	"path/filepath"
+	"runtime"
 	"strings"
 
 	"github.com/go-errors/errors"
@@ -22,3 +25,16 @@ func ensureFirefoxVersion(path string) {
 		Shutdown(errors.New(message))
 	}
 }
+
+// Where Firefox looks for the current user's webextensions' managed storage
+func getManagedStoragePath() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	dir := filepath.Join(home, ".mozilla", "managed-storage")
+	if runtime.GOOS == "darwin" {
+		dir = filepath.Join(home, "Library", "Application Support", "Mozilla", "ManagedStorage")
+	}
+	return filepath.Join(dir, webextensionID+".json"), nil
+}
@@ -5,6 +5,7 @@ package browsh
 import (
 	"fmt"
 	"log/slog"
+	"path/filepath"
 	"strings"
 
 	"github.com/go-errors/errors"
@@ -106,3 +107,17 @@ func ensureFirefoxVersion(path string) {
 		Shutdown(errors.New(message))
 	}
 }
+
+// On Windows, Firefox finds webextensions' managed storage through the registry
+func getManagedStoragePath() (string, error) {
+	path := filepath.Join(getConfigDir(), "managed-storage", webextensionID+".json")
+	k, _, err := registry.CreateKey(
+		registry.CURRENT_USER,
+		`Software\Mozilla\ManagedStorage\`+webextensionID,
+		registry.SET_VALUE)
+	if err != nil {
+		return "", fmt.Errorf("Error writing Windows registry: %w", err)
+	}
+	defer k.Close()
+	return path, k.SetStringValue("", path)
+}
@@ -0,0 +1,205 @@
+package browsh
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"log/slog"
+
+	"github.com/go-errors/errors"
+)
+
+// Frames can be sent by the webextension as binary websocket messages, rather than as
+// JSON, because parsing big JSON frames is most of Browsh's work while scrolling. Every
+// binary message is a frame, laid out as follows, with all integers little endian;
+//
+//	uint8   kind, `binaryFrameText` or `binaryFramePixels`
+//	uint8   version, `binaryFrameVersion`
+//	int32   tab ID, then sub width, sub height, sub left, sub top, total width and
+//	        total height, as in `jsonFrameBase`
+//	colours
+//	text and input boxes, for text frames only
+//
+// Colours are a uint8 encoding and a uint32 length in bytes, followed by either packed
+// RGB bytes or, for run-length encoding, runs of a uint8 count then the run's RGB bytes.
+// Text is a uint32 length in bytes, followed by each cell's UTF-8 prefixed by its uint8
+// length. Input boxes are a uint32 length followed by the same JSON as text frames have.
+//
+// The encoder is `webext/src/dom/binary_frame.js`, which must be changed in step.
+const (
+	binaryFrameText   = 1
+	binaryFramePixels = 2
+
+	binaryFrameVersion = 1
+
+	colourEncodingPacked    = 0
+	colourEncodingRunLength = 1
+)
+
+var errMalformedBinaryFrame = errors.New("Malformed binary frame")
+
+type binaryFrameReader struct {
+	data   []byte
+	offset int
+	err    error
+}
+
+func (r *binaryFrameReader) next(length int) []byte {
+	if r.err != nil || length < 0 || r.offset+length > len(r.data) {
+		r.err = errMalformedBinaryFrame
+		return nil
+	}
+	bytes := r.data[r.offset : r.offset+length]
+	r.offset += length
+	return bytes
+}
+
+func (r *binaryFrameReader) uint8() int {
+	if bytes := r.next(1); bytes != nil {
+		return int(bytes[0])
+	}
+	return 0
+}
+
+func (r *binaryFrameReader) uint32() int {
+	if bytes := r.next(4); bytes != nil {
+		return int(binary.LittleEndian.Uint32(bytes))
+	}
+	return 0
+}
+
+func (r *binaryFrameReader) int32() int {
+	return int(int32(r.uint32()))
+}
+
+func (r *binaryFrameReader) meta() jsonFrameBase {
+	return jsonFrameBase{
+		TabID:       r.int32(),
+		SubWidth:    r.int32(),
+		SubHeight:   r.int32(),
+		SubLeft:     r.int32(),
+		SubTop:      r.int32(),
+		TotalWidth:  r.int32(),
+		TotalHeight: r.int32(),
+	}
+}
+
+// Always returns exactly `count` colours, so a frame can't index past the end of them
+func (r *binaryFrameReader) colours(count int) []int32 {
+	encoding := r.uint8()
+	encoded := r.next(r.uint32())
+	if r.err != nil {
+		return nil
+	}
+	switch encoding {
+	case colourEncodingPacked:
+		if len(encoded) != count*3 {
+			break
+		}
+		colours := make([]int32, len(encoded))
+		for i, c := range encoded {
+			colours[i] = int32(c)
+		}
+		return colours
+	case colourEncodingRunLength:
+		if len(encoded)%4 != 0 || len(encoded)/4*255 < count {
+			break
+		}
+		colours := make([]int32, 0, count*3)
+		for i := 0; i < len(encoded) && len(colours) <= count*3; i += 4 {
+			for run := 0; run < int(encoded[i]); run++ {
+				colours = append(colours,
+					int32(encoded[i+1]), int32(encoded[i+2]), int32(encoded[i+3]))
+			}
+		}
+		if len(colours) == count*3 {
+			return colours
+		}
+	}
+	r.err = errMalformedBinaryFrame
+	return nil
+}
+
+func (r *binaryFrameReader) text(count int) []string {
+	encoded := &binaryFrameReader{data: r.next(r.uint32())}
+	if r.err != nil {
+		return nil
+	}
+	text := make([]string, count)
+	for i := range text {
+		text[i] = string(encoded.next(encoded.uint8()))
+	}
+	if encoded.err != nil || encoded.offset != len(encoded.data) {
+		r.err = errMalformedBinaryFrame
+		return nil
+	}
+	return text
+}
+
+func (r *binaryFrameReader) inputBoxes() map[string]inputBox {
+	encoded := r.next(r.uint32())
+	if r.err != nil {
+		return nil
+	}
+	var inputBoxes map[string]inputBox
+	if err := json.Unmarshal(encoded, &inputBoxes); err != nil {
+		r.err = err
+	}
+	return inputBoxes
+}
+
+func isFrameSizeValid(meta jsonFrameBase) bool {
+	// Pixels come in pairs of rows, one for each half of a TTY cell
+	return meta.SubWidth >= 0 && meta.SubHeight >= 0 && meta.SubHeight%2 == 0 &&
+		meta.SubWidth <= meta.TotalWidth && meta.SubHeight <= meta.TotalHeight
+}
+
+func decodeBinaryFrameText(data []byte) (incomingFrameText, error) {
+	var incoming incomingFrameText
+	r := &binaryFrameReader{data: data, offset: 2}
+	incoming.Meta = r.meta()
+	if r.err == nil && !isFrameSizeValid(incoming.Meta) {
+		return incoming, errMalformedBinaryFrame
+	}
+	cellCount := incoming.Meta.SubWidth * (incoming.Meta.SubHeight / 2)
+	incoming.Colours = r.colours(cellCount)
+	incoming.Text = r.text(cellCount)
+	incoming.InputBoxes = r.inputBoxes()
+	return incoming, r.err
+}
+
+func decodeBinaryFramePixels(data []byte) (incomingFramePixels, error) {
+	var incoming incomingFramePixels
+	r := &binaryFrameReader{data: data, offset: 2}
+	incoming.Meta = r.meta()
+	if r.err == nil && !isFrameSizeValid(incoming.Meta) {
+		return incoming, errMalformedBinaryFrame
+	}
+	incoming.Colours = r.colours(incoming.Meta.SubWidth * incoming.Meta.SubHeight)
+	return incoming, r.err
+}
+
+// Returns whether the frame was used, so that the TTY knows to render it
+func handleBinaryFrame(data []byte) bool {
+	if len(data) < 2 || data[1] != binaryFrameVersion {
+		slog.Error("Binary frame from an unknown version of the webextension")
+		return false
+	}
+	switch data[0] {
+	case binaryFrameText:
+		incoming, err := decodeBinaryFrameText(data)
+		if err != nil {
+			slog.Error("Couldn't decode binary text frame", "error", err)
+			return false
+		}
+		return buildIncomingFrameText(incoming)
+	case binaryFramePixels:
+		incoming, err := decodeBinaryFramePixels(data)
+		if err != nil {
+			slog.Error("Couldn't decode binary pixels frame", "error", err)
+			return false
+		}
+		return buildIncomingFramePixels(incoming)
+	}
+	slog.Error("Unknown kind of binary frame", "kind", data[0])
+	return false
+}
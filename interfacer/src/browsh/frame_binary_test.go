@@ -0,0 +1,119 @@
+package browsh
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"testing"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+func TestFrameBinary(t *testing.T) {
+	RegisterFailHandler(Fail)
+}
+
+// A text frame made by `encodeTextFrame()` in `webext/src/dom/binary_frame.js`, so that
+// both sides are kept to the same layout. Its colours are run-length encoded.
+const webextBinaryTextFrame = "010101000000030000000400000000000000000000000300000004000000010c0000000301" +
+	"020302090909010707070f000000016102c3a90004f09f988001200162630000007b2278223a7b226964" +
+	"223a2278222c2278223a312c2279223a322c227769647468223a332c22686569676874223a342c227461" +
+	"675f6e616d65223a22494e505554222c2274797065223a2274657874222c22636f6c6f7572223a5b312c" +
+	"322c335d7d7d"
+
+func testBinaryFrame(kind byte, meta jsonFrameBase, colours []byte) []byte {
+	frame := []byte{kind, binaryFrameVersion}
+	for _, value := range []int{meta.TabID, meta.SubWidth, meta.SubHeight, meta.SubLeft,
+		meta.SubTop, meta.TotalWidth, meta.TotalHeight} {
+		frame = binary.LittleEndian.AppendUint32(frame, uint32(value))
+	}
+	frame = append(frame, colourEncodingPacked)
+	frame = binary.LittleEndian.AppendUint32(frame, uint32(len(colours)))
+	return append(frame, colours...)
+}
+
+func testBinaryTextFrame(meta jsonFrameBase, colours []byte, text []string) []byte {
+	frame := testBinaryFrame(binaryFrameText, meta, colours)
+	var encoded []byte
+	for _, cell := range text {
+		encoded = append(encoded, byte(len(cell)))
+		encoded = append(encoded, cell...)
+	}
+	frame = binary.LittleEndian.AppendUint32(frame, uint32(len(encoded)))
+	frame = append(frame, encoded...)
+	frame = binary.LittleEndian.AppendUint32(frame, 2)
+	return append(frame, "{}"...)
+}
+
+var _ = Describe("Binary frames", func() {
+	meta := jsonFrameBase{TabID: 1, SubWidth: 2, SubHeight: 4, TotalWidth: 2, TotalHeight: 8}
+	textColours := []byte{77, 77, 77, 101, 101, 101, 102, 102, 102, 103, 103, 103}
+	pixelColours := []byte{
+		254, 254, 254, 111, 111, 111,
+		1, 1, 1, 2, 2, 2,
+		3, 3, 3, 4, 4, 4,
+		123, 123, 123, 200, 200, 200,
+	}
+
+	BeforeEach(func() {
+		newTab(1)
+	})
+
+	It("should decode frames from the webextension", func() {
+		data, _ := hex.DecodeString(webextBinaryTextFrame)
+		incoming, err := decodeBinaryFrameText(data)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(incoming.Meta.SubWidth).To(Equal(3))
+		Expect(incoming.Text).To(Equal([]string{"a", "é", "", "😀", " ", "b"}))
+		Expect(incoming.Colours).To(Equal([]int32{
+			1, 2, 3, 1, 2, 3, 1, 2, 3, 9, 9, 9, 9, 9, 9, 7, 7, 7,
+		}))
+		Expect(incoming.InputBoxes["x"].TagName).To(Equal("INPUT"))
+	})
+
+	It("should build the same cells as JSON frames", func() {
+		Expect(handleBinaryFrame(testBinaryTextFrame(meta, textColours,
+			[]string{"A", "b", "c", ""}))).To(BeTrue())
+		Expect(handleBinaryFrame(testBinaryFrame(binaryFramePixels, meta, pixelColours))).
+			To(BeTrue())
+		Expect(testGetCell(0).character[0]).To(Equal('A'))
+		Expect(testGetCell(3).character[0]).To(Equal('▄'))
+		r, g, b := testGetCell(3).fgColour.RGB()
+		Expect([3]int32{r, g, b}).To(Equal([3]int32{200, 200, 200}))
+		r, g, b = testGetCell(0).bgColour.RGB()
+		Expect([3]int32{r, g, b}).To(Equal([3]int32{254, 254, 254}))
+	})
+
+	It("should decode run-length encoded colours", func() {
+		frame := testBinaryFrame(binaryFramePixels, meta, []byte{3, 1, 2, 3, 5, 4, 5, 6})
+		frame[30] = colourEncodingRunLength
+		incoming, err := decodeBinaryFramePixels(frame)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(incoming.Colours[6:9]).To(Equal([]int32{1, 2, 3}))
+		Expect(incoming.Colours[21:24]).To(Equal([]int32{4, 5, 6}))
+	})
+
+	It("should refuse frames that don't have a colour for every cell", func() {
+		_, err := decodeBinaryFramePixels(testBinaryFrame(binaryFramePixels, meta,
+			pixelColours[:21]))
+		Expect(err).To(MatchError(errMalformedBinaryFrame))
+		frame := testBinaryFrame(binaryFramePixels, meta, []byte{255, 1, 2, 3})
+		frame[30] = colourEncodingRunLength
+		_, err = decodeBinaryFramePixels(frame)
+		Expect(err).To(MatchError(errMalformedBinaryFrame))
+	})
+
+	It("should refuse frames that are cut short", func() {
+		frame := testBinaryTextFrame(meta, textColours, []string{"A", "b", "c", ""})
+		for _, length := range []int{10, 40, len(frame) - 3} {
+			_, err := decodeBinaryFrameText(frame[:length])
+			Expect(err).To(HaveOccurred())
+		}
+	})
+
+	It("should ignore frames from other versions of the webextension", func() {
+		frame := testBinaryFrame(binaryFramePixels, meta, pixelColours)
+		frame[1] = binaryFrameVersion + 1
+		Expect(handleBinaryFrame(frame)).To(BeFalse())
+	})
+})
@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"log/slog"
+	"sync"
 	"unicode"
 
 	"github.com/gdamore/tcell"
@@ -32,13 +33,22 @@ type frame struct {
 	// of a different size and shape will interact with data from another DOM.
 	isDOMSizeChanged bool
 	// Raw data used to build a single, usable frame
-	pixels      map[int][2]tcell.Color
-	text        map[int][]rune
-	textColours map[int]tcell.Color
+	pixels *denseGrid[[2]tcell.Color]
+	text   *denseGrid[textCell]
 	// The actual built frame, can be used to render cells to the TTY
-	cells *threadSafeCellsMap
+	cells *denseGrid[cell]
 	// Input boxes, like for entering passwords, sending emails etc
 	inputBoxes map[string]*inputBox
+	// The regions of cells that have changed since the frame was last rendered, so that
+	// only they need drawing again
+	dirty      []cellRegion
+	isAllDirty bool
+	dirtyLock  sync.Mutex
+}
+
+type textCell struct {
+	character []rune
+	colour    tcell.Color
 }
 
 type jsonFrameBase struct {
@@ -58,7 +68,7 @@ type incomingFrameText struct {
 	InputBoxes map[string]inputBox `json:"input_boxes"`
 }
 
-// TODO: Can these be sent as binary blobs?
+// Also sent as binary, see `frame_binary.go`
 type incomingFramePixels struct {
 	Meta    jsonFrameBase `json:"meta"`
 	Colours []int32       `json:"colours"`
@@ -78,13 +88,19 @@ func parseJSONFrameText(jsonString string) {
 	if err := json.Unmarshal(jsonBytes, &incoming); err != nil {
 		Shutdown(err)
 	}
+	buildIncomingFrameText(incoming)
+}
+
+// Returns whether there was a tab to build the frame for
+func buildIncomingFrameText(incoming incomingFrameText) bool {
 	if !isTabPresent(incoming.Meta.TabID) {
 		slog.Info(
 			fmt.Sprintf("Not building frame for non-existent tab ID: %d", incoming.Meta.TabID),
 		)
-		return
+		return false
 	}
 	Tabs[incoming.Meta.TabID].frame.buildFrameText(incoming)
+	return true
 }
 
 func (f *frame) buildFrameText(incoming incomingFrameText) {
@@ -102,14 +118,20 @@ func parseJSONFramePixels(jsonString string) {
 	if err := json.Unmarshal(jsonBytes, &incoming); err != nil {
 		Shutdown(err)
 	}
+	buildIncomingFramePixels(incoming)
+}
+
+// Returns whether there was a tab to build the frame for
+func buildIncomingFramePixels(incoming incomingFramePixels) bool {
 	if !isTabPresent(incoming.Meta.TabID) {
 		slog.Warn("Not building frame for non-existent tab ID", "TabID", incoming.Meta.TabID)
-		return
+		return false
 	}
-	if len(Tabs[incoming.Meta.TabID].frame.text) == 0 {
-		return
+	if Tabs[incoming.Meta.TabID].frame.text == nil {
+		return false
 	}
 	Tabs[incoming.Meta.TabID].frame.buildFramePixels(incoming)
+	return true
 }
 
 func (f *frame) buildFramePixels(incoming incomingFramePixels) {
@@ -122,9 +144,6 @@ func (f *frame) buildFramePixels(incoming incomingFramePixels) {
 
 func (f *frame) setup(meta jsonFrameBase) {
 	f.isDOMSizeChanged = meta.TotalWidth != f.totalWidth || meta.TotalHeight != f.totalHeight
-	if f.isDOMSizeChanged || f.cells == nil {
-		f.resetCells()
-	}
 	if f.inputBoxes == nil {
 		f.inputBoxes = make(map[string]*inputBox)
 	}
@@ -134,10 +153,24 @@ func (f *frame) setup(meta jsonFrameBase) {
 	f.totalHeight = meta.TotalHeight
 	f.subLeft = meta.SubLeft
 	f.subTop = meta.SubTop
+	if f.isDOMSizeChanged || f.cells == nil {
+		f.resetCells()
+	}
 }
 
 func (f *frame) resetCells() {
-	f.cells = newCellsMap()
+	f.cells = newCellsGrid(f.totalWidth, f.domRowCount())
+	f.markAllDirty()
+}
+
+// The cells that a sub frame covers
+func (f *frame) subRegion() cellRegion {
+	return cellRegion{
+		left:   f.subLeft,
+		top:    f.subTop / 2,
+		right:  f.subLeft + f.subWidth,
+		bottom: (f.subTop + f.subHeight) / 2,
+	}
 }
 
 func (f *frame) isIncomingFrameTextValid(incoming incomingFrameText) bool {
@@ -174,30 +207,32 @@ func (f *frame) updateInputBoxes(incoming incomingFrameText) {
 
 func (f *frame) populateFrameText(incoming incomingFrameText) {
 	var cellIndex, frameIndex, colourIndex int
-	if f.isDOMSizeChanged || f.text == nil {
-		f.text = make(map[int][]rune, (f.domRowCount())*f.totalWidth)
-		f.textColours = make(map[int]tcell.Color, (f.domRowCount())*f.totalWidth)
+	if f.isDOMSizeChanged || !f.text.hasSize(f.totalWidth, f.domRowCount()) {
+		f.text = newDenseGrid[textCell](f.totalWidth, f.domRowCount())
 	}
 	for y := 0; y < f.subRowCount(); y++ {
 		for x := 0; x < f.subWidth; x++ {
 			cellIndex = f.getCellIndexFromSubCoords(x, y*2)
 			frameIndex = (y * f.subWidth) + x
 			colourIndex = frameIndex * 3
-			f.textColours[cellIndex] = tcell.NewRGBColor(
-				incoming.Colours[colourIndex+0],
-				incoming.Colours[colourIndex+1],
-				incoming.Colours[colourIndex+2],
-			)
-			f.text[cellIndex] = []rune(incoming.Text[frameIndex])
+			f.text.store(cellIndex, textCell{
+				character: []rune(incoming.Text[frameIndex]),
+				colour: tcell.NewRGBColor(
+					incoming.Colours[colourIndex+0],
+					incoming.Colours[colourIndex+1],
+					incoming.Colours[colourIndex+2],
+				),
+			})
 			f.buildCell(f.subLeft+x, (f.subTop/2)+y)
 		}
 	}
+	f.markDirty(f.subRegion())
 }
 
 func (f *frame) populateFramePixels(incoming incomingFramePixels) {
 	var cellIndex, frameIndexFg, frameIndexBg, pixelIndexFg, pixelIndexBg int
-	if f.isDOMSizeChanged || f.pixels == nil {
-		f.pixels = make(map[int][2]tcell.Color, f.totalHeight*f.totalWidth)
+	if f.isDOMSizeChanged || !f.pixels.hasSize(f.totalWidth, f.domRowCount()) {
+		f.pixels = newDenseGrid[[2]tcell.Color](f.totalWidth, f.domRowCount())
 	}
 	data := incoming.Colours
 	for y := 0; y < f.subHeight; y += 2 {
@@ -219,10 +254,11 @@ func (f *frame) populateFramePixels(incoming incomingFramePixels) {
 					data[pixelIndexFg+2],
 				),
 			}
-			f.pixels[cellIndex] = pixels
+			f.pixels.store(cellIndex, pixels)
 			f.buildCell(f.subLeft+x, (f.subTop+y)/2)
 		}
 	}
+	f.markDirty(f.subRegion())
 }
 
 func (f *frame) isIncomingFramePixelsValid(incoming incomingFramePixels) bool {
@@ -252,9 +288,9 @@ func (f *frame) buildCell(x int, y int) {
 func (f *frame) getCharacterAt(index int) ([]rune, tcell.Color) {
 	var colour tcell.Color
 	var character []rune
-	if result, ok := f.text[index]; ok {
-		character = result
-		colour = f.textColours[index]
+	if result, ok := f.text.load(index); ok {
+		character = result.character
+		colour = result.colour
 	} else {
 		character = []rune(" ")
 		colour = tcell.ColorBlack
@@ -264,7 +300,7 @@ func (f *frame) getCharacterAt(index int) ([]rune, tcell.Color) {
 
 func (f *frame) getPixelColoursAt(index int) (tcell.Color, tcell.Color) {
 	var fgColour, bgColour tcell.Color
-	if result, ok := f.pixels[index]; ok {
+	if result, ok := f.loadPixels(index); ok {
 		bgColour = result[0]
 		fgColour = result[1]
 	} else {
@@ -274,6 +310,14 @@ func (f *frame) getPixelColoursAt(index int) (tcell.Color, tcell.Color) {
 	return fgColour, bgColour
 }
 
+// Pixels can be built before there are any
+func (f *frame) loadPixels(index int) ([2]tcell.Color, bool) {
+	if f.pixels == nil {
+		return [2]tcell.Color{}, false
+	}
+	return f.pixels.load(index)
+}
+
 func isCharacterTransparent(character []rune) bool {
 	return string(character) == "" || unicode.IsSpace(character[0])
 }
@@ -33,49 +33,50 @@ func debugCells() {
 	}
 }
 
+// Also used by the benchmarks in `cells_test.go`
+var frameJSONText = `{
+	"meta": {
+		"id": 1,
+		"sub_left": 0,
+		"sub_top": 0,
+		"sub_width": 2,
+		"sub_height": 4,
+		"total_width": 2,
+		"total_height": 8
+	},
+	"text": ["A", "b", "c", ""],
+	"colours": [
+		77, 77, 77,
+		101, 101, 101,
+		102, 102, 102,
+		103, 103, 103
+	]
+}`
+
+var frameJSONPixels = `{
+	"meta": {
+		"id": 1,
+		"sub_left": 0,
+		"sub_top": 0,
+		"sub_width": 2,
+		"sub_height": 4,
+		"total_width": 2,
+		"total_height": 8
+	},
+	"colours": [
+		254, 254, 254, 111, 111, 111,
+		1, 1, 1, 2, 2, 2,
+		3, 3, 3, 4, 4, 4,
+		123, 123, 123, 200, 200, 200
+	]
+}`
+
 var _ = Describe("Frame struct", func() {
 	BeforeEach(func() {
 		newTab(1)
 	})
 
 	Describe("No Offset", func() {
-		var frameJSONText = `{
-			"meta": {
-				"id": 1,
-				"sub_left": 0,
-				"sub_top": 0,
-				"sub_width": 2,
-				"sub_height": 4,
-				"total_width": 2,
-				"total_height": 8
-			},
-			"text": ["A", "b", "c", ""],
-			"colours": [
-				77, 77, 77,
-				101, 101, 101,
-				102, 102, 102,
-				103, 103, 103
-			]
-		}`
-
-		var frameJSONPixels = `{
-			"meta": {
-				"id": 1,
-				"sub_left": 0,
-				"sub_top": 0,
-				"sub_width": 2,
-				"sub_height": 4,
-				"total_width": 2,
-				"total_height": 8
-			},
-			"colours": [
-				254, 254, 254, 111, 111, 111,
-				1, 1, 1, 2, 2, 2,
-				3, 3, 3, 4, 4, 4,
-				123, 123, 123, 200, 200, 200
-			]
-		}`
-
 		BeforeEach(func() {
 			parseJSONFrameText(frameJSONText)
 		})
@@ -106,6 +107,41 @@ var _ = Describe("Frame struct", func() {
 		})
 	})
 
+	Describe("Growing page", func() {
+		grownFrame := func(kind string, data string) string {
+			return `{
+				"meta": {
+					"id": 1,
+					"sub_left": 0,
+					"sub_top": 8,
+					"sub_width": 2,
+					"sub_height": 4,
+					"total_width": 2,
+					"total_height": 12
+				},
+				` + kind + `: ` + data + `
+			}`
+		}
+
+		It("should keep pixels for rows added by an earlier text frame", func() {
+			var r, g, b int32
+			parseJSONFrameText(frameJSONText)
+			parseJSONFramePixels(frameJSONPixels)
+			parseJSONFrameText(grownFrame(`"text": ["", "", "", ""], "colours"`,
+				"[0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0]"))
+			parseJSONFramePixels(grownFrame(`"colours"`, `[
+				1, 1, 1, 2, 2, 2,
+				3, 3, 3, 4, 4, 4,
+				5, 5, 5, 6, 6, 6,
+				7, 7, 7, 8, 8, 8
+			]`))
+			r, g, b = testGetCell(11).bgColour.RGB()
+			Expect([3]int32{r, g, b}).To(Equal([3]int32{6, 6, 6}))
+			r, g, b = testGetCell(11).fgColour.RGB()
+			Expect([3]int32{r, g, b}).To(Equal([3]int32{8, 8, 8}))
+		})
+	})
+
 	Describe("With Offset", func() {
 		var subFrameJSONText = `{
 			"meta": {
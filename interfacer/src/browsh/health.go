@@ -0,0 +1,96 @@
+package browsh
+
+import (
+	"net/http"
+
+	"github.com/spf13/viper"
+)
+
+const (
+	healthPath    = "/healthz"
+	readinessPath = "/readyz"
+)
+
+type browserHealth struct {
+	ID                    int  `json:"id"`
+	FirefoxRunning        bool `json:"firefox_running"`
+	MarionetteConnected   bool `json:"marionette_connected"`
+	WebExtensionConnected bool `json:"webextension_connected"`
+}
+
+type queueHealth struct {
+	Active  int  `json:"active"`
+	Waiting int  `json:"waiting"`
+	IsFull  bool `json:"is_full"`
+}
+
+type healthReport struct {
+	Status   string          `json:"status"`
+	Browsers []browserHealth `json:"browsers"`
+	Queue    queueHealth     `json:"queue"`
+}
+
+func (b browserHealth) isReady() bool {
+	return b.FirefoxRunning && b.MarionetteConnected && b.WebExtensionConnected
+}
+
+// Browsh is alive for as long as it has a Firefox, even if that Firefox isn't ready yet.
+// When every Firefox has died, restarting Browsh is the only way to get them back.
+func handleHealthRequest(w http.ResponseWriter, r *http.Request) {
+	report := getHealthReport()
+	isAlive := false
+	for _, browser := range report.Browsers {
+		isAlive = isAlive || browser.FirefoxRunning
+	}
+	writeHealthReport(w, report, isAlive)
+}
+
+// Ready to render means at least one Firefox can be given a page, and there's room for
+// it in the render queue
+func handleReadinessRequest(w http.ResponseWriter, r *http.Request) {
+	report := getHealthReport()
+	isReady := false
+	for _, browser := range report.Browsers {
+		isReady = isReady || browser.isReady()
+	}
+	writeHealthReport(w, report, isReady && !report.Queue.IsFull)
+}
+
+func writeHealthReport(w http.ResponseWriter, report healthReport, isOK bool) {
+	status := http.StatusOK
+	report.Status = "ok"
+	if !isOK {
+		status = http.StatusServiceUnavailable
+		report.Status = "unavailable"
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	writeAPIJSON(w, status, report)
+}
+
+func getHealthReport() healthReport {
+	active, waiting := renderQueue.depth()
+	return healthReport{
+		Browsers: getBrowsersHealth(),
+		Queue: queueHealth{
+			Active:  active,
+			Waiting: waiting,
+			IsFull:  renderQueue.isFull(),
+		},
+	}
+}
+
+func getBrowsersHealth() []browserHealth {
+	if browserPool != nil {
+		return browserPool.health()
+	}
+	health := browserHealth{
+		FirefoxRunning:        isFirefoxRunning.Load(),
+		MarionetteConnected:   isMarionetteConnected(marionette),
+		WebExtensionConnected: webextension.isConnected(),
+	}
+	// Browsh doesn't know about the processes of Firefoxes that it didn't start
+	if viper.GetBool("firefox.use-existing") {
+		health.FirefoxRunning = health.MarionetteConnected
+	}
+	return []browserHealth{health}
+}
@@ -0,0 +1,98 @@
+package browsh
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+func TestHealth(t *testing.T) {
+	RegisterFailHandler(Fail)
+}
+
+var _ = Describe("Health checks", func() {
+	check := func(handler http.HandlerFunc) (int, healthReport) {
+		var report healthReport
+		recorder := httptest.NewRecorder()
+		handler(recorder, httptest.NewRequest("GET", "/", nil))
+		json.Unmarshal(recorder.Body.Bytes(), &report)
+		return recorder.Code, report
+	}
+
+	AfterEach(func() {
+		isFirefoxRunning.Store(false)
+		browserPool = nil
+		renderQueue = nil
+	})
+
+	Describe("with a single browser", func() {
+		It("should not be alive without Firefox", func() {
+			status, report := check(handleHealthRequest)
+			Expect(status).To(Equal(http.StatusServiceUnavailable))
+			Expect(report.Status).To(Equal("unavailable"))
+			Expect(report.Browsers[0].FirefoxRunning).To(BeFalse())
+		})
+
+		It("should be alive but not ready while the webextension connects", func() {
+			isFirefoxRunning.Store(true)
+			status, _ := check(handleHealthRequest)
+			Expect(status).To(Equal(http.StatusOK))
+			status, report := check(handleReadinessRequest)
+			Expect(status).To(Equal(http.StatusServiceUnavailable))
+			Expect(report.Browsers[0].WebExtensionConnected).To(BeFalse())
+		})
+	})
+
+	Describe("with a pool of browsers", func() {
+		BeforeEach(func() {
+			browserPool = newFirefoxPool(2, 2830, "least-busy", 0)
+			for _, instance := range browserPool.instances {
+				instance.exited = make(chan struct{})
+			}
+		})
+
+		It("should report on every browser", func() {
+			close(browserPool.instances[1].exited)
+			_, report := check(handleHealthRequest)
+			Expect(report.Browsers).To(HaveLen(2))
+			Expect(report.Browsers[0].FirefoxRunning).To(BeTrue())
+			Expect(report.Browsers[1].ID).To(Equal(1))
+			Expect(report.Browsers[1].FirefoxRunning).To(BeFalse())
+		})
+
+		It("should not be ready when no webextension has connected", func() {
+			status, _ := check(handleReadinessRequest)
+			Expect(status).To(Equal(http.StatusServiceUnavailable))
+		})
+	})
+
+	Describe("with a render queue", func() {
+		BeforeEach(func() {
+			renderQueue = newRenderJobQueue(1, 1, time.Second)
+		})
+
+		It("should report the queue's depth", func() {
+			Expect(renderQueue.start(context.Background())).To(Succeed())
+			_, report := check(handleHealthRequest)
+			Expect(report.Queue.Active).To(Equal(1))
+			Expect(report.Queue.IsFull).To(BeFalse())
+		})
+
+		It("should not be ready when the queue is full", func() {
+			Expect(renderQueue.start(context.Background())).To(Succeed())
+			go renderQueue.start(context.Background())
+			Eventually(func() bool { return renderQueue.isFull() }).Should(BeTrue())
+			status, report := check(handleReadinessRequest)
+			Expect(status).To(Equal(http.StatusServiceUnavailable))
+			Expect(report.Queue.IsFull).To(BeTrue())
+			renderQueue.done()
+			renderQueue.done()
+		})
+	})
+})
@@ -1,7 +1,6 @@
 package browsh
 
 import (
-	"encoding/json"
 	"unicode/utf8"
 
 	"github.com/gdamore/tcell"
@@ -166,20 +165,15 @@ func isLineBreak(character string) bool {
 }
 
 func (i *inputBox) sendInputBoxToBrowser() {
-	inputBoxMap := map[string]interface{}{
-		"id":   i.ID,
-		"text": string(i.text),
-	}
-	marshalled, _ := json.Marshal(inputBoxMap)
-	sendMessageToWebExtension("/tab_command,/input_box," + string(marshalled))
+	sendTabCommand("/input_box", inputBoxPayload{ID: i.ID, Text: string(i.text)})
 }
 
 func (i *inputBox) handleEnterKey(modifier tcell.ModMask) {
 	if urlInputBox.isActive {
 		if isNewEmptyTabActive() {
-			sendMessageToWebExtension("/new_tab," + string(i.text))
+			sendCommandToWebExtension("/new_tab", newTabPayload{URL: string(i.text)})
 		} else {
-			sendMessageToWebExtension("/url_bar," + string(i.text))
+			sendCommandToWebExtension("/url_bar", urlBarPayload{Input: string(i.text)})
 		}
 		urlBarFocus(false)
 	}
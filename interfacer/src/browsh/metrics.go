@@ -0,0 +1,205 @@
+package browsh
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const metricsPath = "/metrics"
+
+// Browsh's own registry, rather than Prometheus' global one, so that only Browsh's
+// metrics and the usual Go process metrics are exported
+var (
+	metricsRegistry = prometheus.NewRegistry()
+	metrics         = promauto.With(metricsRegistry)
+
+	metricRequests = metrics.NewCounterVec(prometheus.CounterOpts{
+		Name: "browsh_http_requests_total",
+		Help: "HTTP requests, by raw text mode and response status",
+	}, []string{"mode", "status"})
+	metricRenderDurations = metrics.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "browsh_render_duration_seconds",
+		Help:    "How long renders took, by phase; total, page_load and parsing",
+		Buckets: []float64{0.1, 0.25, 0.5, 1, 2.5, 5, 10, 20, 30, 60},
+	}, []string{"phase"})
+	metricRenderTimeouts = metrics.NewCounter(prometheus.CounterOpts{
+		Name: "browsh_render_timeouts_total",
+		Help: "Renders that gave up waiting for Firefox",
+	})
+	metricCacheLookups = metrics.NewCounterVec(prometheus.CounterOpts{
+		Name: "browsh_render_cache_lookups_total",
+		Help: "Render cache lookups, by whether they were a hit or a miss",
+	}, []string{"result"})
+	metricBlockedRequests = metrics.NewCounterVec(prometheus.CounterOpts{
+		Name: "browsh_blocked_requests_total",
+		Help: "Requests that were refused, by reason",
+	}, []string{"reason"})
+	metricRateLimited = metrics.NewCounter(prometheus.CounterOpts{
+		Name: "browsh_rate_limited_requests_total",
+		Help: "Requests that were refused because of the rate limit",
+	})
+)
+
+// The reasons for `browsh_blocked_requests_total`
+const (
+	blockedDomain      = "domain"
+	blockedUserAgent   = "user_agent"
+	blockedDestination = "destination"
+	blockedAPIKey      = "api_key"
+	blockedQueueFull   = "queue"
+	blockedNoBrowser   = "no_browser"
+)
+
+// Other reasons that requests are refused, which have their own metrics or none at all
+const (
+	rejectedRateLimit       = "rate_limit"
+	rejectedUnauthenticated = "unauthenticated"
+	rejectedNotAdmin        = "not_admin"
+)
+
+func init() {
+	metricsRegistry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+	metrics.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "browsh_webextension_connected",
+		Help: "Whether the webextension is connected to Browsh's websocket",
+	}, func() float64 {
+		if webextension.isConnected() {
+			return 1
+		}
+		return 0
+	})
+	metrics.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "browsh_browsers_connected",
+		Help: "The number of Firefoxes, including pooled ones, whose webextension is connected",
+	}, func() float64 {
+		return float64(connectedBrowsers())
+	})
+	metrics.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "browsh_render_queue_active",
+		Help: "Renders in progress, when render concurrency is limited",
+	}, func() float64 {
+		active, _ := renderQueue.depth()
+		return float64(active)
+	})
+	metrics.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "browsh_render_queue_waiting",
+		Help: "Renders waiting for their turn, when render concurrency is limited",
+	}, func() float64 {
+		_, waiting := renderQueue.depth()
+		return float64(waiting)
+	})
+}
+
+func metricsHandler() http.Handler {
+	return promhttp.HandlerFor(metricsRegistry, promhttp.HandlerOpts{})
+}
+
+// What a request ended up being, filled in as it's handled, for the metrics and the
+// access log
+type requestInfo struct {
+	url              string
+	mode             string
+	status           int
+	bytes            int
+	totalDuration    int
+	pageloadDuration int
+	parsingDuration  int
+	cache            string
+	rejection        string
+}
+
+type requestInfoContextKey struct{}
+
+type statusRecorder struct {
+	http.ResponseWriter
+	info *requestInfo
+}
+
+func (s *statusRecorder) WriteHeader(status int) {
+	if s.info.status == 0 {
+		s.info.status = status
+	}
+	s.ResponseWriter.WriteHeader(status)
+}
+
+func (s *statusRecorder) Write(data []byte) (int, error) {
+	if s.info.status == 0 {
+		s.info.status = http.StatusOK
+	}
+	written, err := s.ResponseWriter.Write(data)
+	s.info.bytes += written
+	return written, err
+}
+
+// Count every request, including ones turned away by the rate limiter or for not having
+// an API key, so this wraps everything else.
+func instrument(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		info := &requestInfo{}
+		r = r.WithContext(context.WithValue(r.Context(), requestInfoContextKey{}, info))
+		h.ServeHTTP(&statusRecorder{ResponseWriter: w, info: info}, r)
+		if info.status == 0 {
+			info.status = http.StatusOK
+		}
+		metricRequests.WithLabelValues(info.mode, strconv.Itoa(info.status)).Inc()
+		writeAccessLog(r, start, info)
+	})
+}
+
+func getRequestInfo(r *http.Request) *requestInfo {
+	if info, ok := r.Context().Value(requestInfoContextKey{}).(*requestInfo); ok {
+		return info
+	}
+	// Requests that aren't instrumented, like in tests, can still be described
+	return &requestInfo{}
+}
+
+// Let the instrumentation know what the request was for
+func setRequestTarget(r *http.Request, urlForBrowsh, mode string) {
+	info := getRequestInfo(r)
+	info.url = urlForBrowsh
+	info.mode = mode
+}
+
+// Let the instrumentation know how a page was rendered. Cached renders keep the timings
+// of when they were originally rendered.
+func setRequestRender(r *http.Request, render *cachedRender, isCached bool) {
+	info := getRequestInfo(r)
+	response := unpackResponse(render.Response)
+	info.totalDuration = render.TotalDuration
+	info.pageloadDuration = response.PageloadDuration
+	info.parsingDuration = response.ParsingDuration
+	if renderCache != nil {
+		info.cache = cacheStatus(isCached)
+	}
+}
+
+// Let the instrumentation know why a request was refused
+func setRequestRejection(r *http.Request, reason string) {
+	getRequestInfo(r).rejection = reason
+}
+
+// For the refusals that are also counted in `browsh_blocked_requests_total`
+func blockRequest(r *http.Request, reason string) {
+	metricBlockedRequests.WithLabelValues(reason).Inc()
+	setRequestRejection(r, reason)
+}
+
+func observeRender(totalDuration int, response rawTextResponse) {
+	metricRenderDurations.WithLabelValues("total").Observe(float64(totalDuration) / 1000)
+	metricRenderDurations.WithLabelValues("page_load").Observe(
+		float64(response.PageloadDuration) / 1000)
+	metricRenderDurations.WithLabelValues("parsing").Observe(
+		float64(response.ParsingDuration) / 1000)
+}
@@ -0,0 +1,52 @@
+package browsh
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestMetrics(t *testing.T) {
+	RegisterFailHandler(Fail)
+}
+
+var _ = Describe("Metrics", func() {
+	serve := func(handler http.HandlerFunc) {
+		request := httptest.NewRequest("GET", "/https://www.brow.sh", nil)
+		instrument(handler).ServeHTTP(httptest.NewRecorder(), request)
+	}
+
+	It("should count requests by mode and status", func() {
+		counter := metricRequests.WithLabelValues("MARKDOWN", "404")
+		before := testutil.ToFloat64(counter)
+		serve(func(w http.ResponseWriter, r *http.Request) {
+			setRequestTarget(r, "https://www.brow.sh", "MARKDOWN")
+			http.NotFound(w, r)
+		})
+		Expect(testutil.ToFloat64(counter)).To(Equal(before + 1))
+	})
+
+	It("should count requests that only write a body as OK", func() {
+		counter := metricRequests.WithLabelValues("PLAIN", "200")
+		before := testutil.ToFloat64(counter)
+		serve(func(w http.ResponseWriter, r *http.Request) {
+			setRequestTarget(r, "https://www.brow.sh", "PLAIN")
+			w.Write([]byte("rendered"))
+		})
+		Expect(testutil.ToFloat64(counter)).To(Equal(before + 1))
+	})
+
+	It("should export Browsh's metrics", func() {
+		observeRender(1500, rawTextResponse{PageloadDuration: 1000, ParsingDuration: 200})
+		recorder := httptest.NewRecorder()
+		metricsHandler().ServeHTTP(recorder, httptest.NewRequest("GET", metricsPath, nil))
+		Expect(recorder.Body.String()).To(ContainSubstring(
+			`browsh_render_duration_seconds_count{phase="page_load"}`))
+		Expect(recorder.Body.String()).To(ContainSubstring("browsh_webextension_connected 0"))
+		Expect(recorder.Body.String()).To(ContainSubstring("go_goroutines"))
+	})
+})
@@ -0,0 +1,195 @@
+package browsh
+
+import (
+	"encoding/json"
+	"log/slog"
+	"strconv"
+	"sync"
+
+	"github.com/spf13/viper"
+)
+
+// Must be the same as `PROTOCOL_VERSION` in `webext/src/background/protocol.js`. Bump
+// both whenever either side changes how it reads or writes messages.
+const protocolVersion = 1
+
+// Every message between Browsh and the webextension, in either direction, is one of
+// these encoded as JSON. `TabID` is for commands about a particular tab and
+// `CorrelationID` matches a response to its request, like with raw text.
+type webextensionMessage struct {
+	Version       int             `json:"version"`
+	Command       string          `json:"command"`
+	TabID         int             `json:"tab_id,omitempty"`
+	CorrelationID string          `json:"correlation_id,omitempty"`
+	Payload       json.RawMessage `json:"payload,omitempty"`
+}
+
+// Sent by both sides as soon as the websocket connects
+type helloPayload struct {
+	ProtocolVersion int    `json:"protocol_version"`
+	BrowshVersion   string `json:"browsh_version"`
+	// Whether frames can be sent as binary, see `frame_binary.go`. Otherwise they're
+	// sent as JSON.
+	BinaryFrames bool `json:"binary_frames"`
+}
+
+// Payloads sent to the webextension
+
+type newTabPayload struct {
+	URL string `json:"url"`
+}
+
+type urlBarPayload struct {
+	Input string `json:"input"`
+}
+
+type statusPayload struct {
+	Message string `json:"message"`
+}
+
+// A command for a tab's content script, passed on by the webextension to the tab in
+// the envelope's `tab_id`
+type tabCommandPayload struct {
+	Command string      `json:"command"`
+	Payload interface{} `json:"payload,omitempty"`
+}
+
+// The TTY's scroll position, for the content script to scroll the page to
+type scrollStatusPayload struct {
+	X int `json:"x"`
+	Y int `json:"y"`
+}
+
+type inputBoxPayload struct {
+	ID   string `json:"id"`
+	Text string `json:"text"`
+}
+
+type ttySizePayload struct {
+	Width  int `json:"width"`
+	Height int `json:"height"`
+}
+
+type keyPressPayload struct {
+	Key  int    `json:"key"`
+	Char string `json:"char"`
+	Mod  int    `json:"mod"`
+}
+
+type mouseEventPayload struct {
+	Button    int `json:"button"`
+	MouseX    int `json:"mouse_x"`
+	MouseY    int `json:"mouse_y"`
+	Modifiers int `json:"modifiers"`
+}
+
+// Raw text requests have their own type, see `outgoingRawTextRequest`.
+
+// Payloads sent by the webextension. Frames, tab state and raw text have their own
+// types, see `incomingFrameText`, `incomingFramePixels`, `tab` and `rawTextResponse`.
+
+type screenshotPayload struct {
+	Data string `json:"data"`
+}
+
+// Why the webextension stopped a page from loading, either "private_network" or
+// `rawTextBlockedAllowedDomains`
+type rawTextBlockedPayload struct {
+	Reason string `json:"reason"`
+}
+
+const rawTextBlockedAllowedDomains = "allowed_domains"
+
+type logPayload struct {
+	Message string `json:"message"`
+}
+
+// So that a webextension on the wrong protocol is only complained about once, rather
+// than for every one of its messages
+var warnAboutUnknownMessagesOnce sync.Once
+
+func newWebextensionMessage(command string, payload interface{}) webextensionMessage {
+	message := webextensionMessage{Version: protocolVersion, Command: command}
+	if payload != nil {
+		encoded, err := json.Marshal(payload)
+		if err != nil {
+			slog.Error("Couldn't encode message for the webextension",
+				"command", command, "error", err)
+		}
+		message.Payload = encoded
+	}
+	return message
+}
+
+func newTabMessage(command string, tabID int, payload interface{}) webextensionMessage {
+	message := newWebextensionMessage(command, payload)
+	message.TabID = tabID
+	return message
+}
+
+func newCorrelatedMessage(command, correlationID string, payload interface{}) webextensionMessage {
+	message := newWebextensionMessage(command, payload)
+	message.CorrelationID = correlationID
+	return message
+}
+
+func newHelloMessage() webextensionMessage {
+	return newWebextensionMessage("/hello", helloPayload{
+		ProtocolVersion: protocolVersion,
+		BrowshVersion:   browshVersion,
+		BinaryFrames:    viper.GetBool("browsh.binary-frames"),
+	})
+}
+
+func (m webextensionMessage) encode() string {
+	encoded, _ := json.Marshal(m)
+	return string(encoded)
+}
+
+func decodeWebextensionMessage(raw []byte) (webextensionMessage, error) {
+	var message webextensionMessage
+	err := json.Unmarshal(raw, &message)
+	return message, err
+}
+
+func (m webextensionMessage) decodePayload(payload interface{}) bool {
+	if err := json.Unmarshal(m.Payload, payload); err != nil {
+		slog.Error("Couldn't decode message from the webextension",
+			"command", m.Command, "error", err)
+		return false
+	}
+	return true
+}
+
+// Browsh always runs the webextension that's embedded in it, so a mismatch most likely
+// means that the webextension was built from a different checkout than the Go binary.
+func checkWebextensionVersion(hello helloPayload) {
+	if hello.ProtocolVersion != protocolVersion {
+		warnAboutWebextensionVersion("Firefox's Browsh webextension speaks protocol v" +
+			strconv.Itoa(hello.ProtocolVersion) + ", but Browsh speaks v" +
+			strconv.Itoa(protocolVersion) + ". Please reinstall Browsh.")
+		return
+	}
+	if hello.BrowshVersion != browshVersion {
+		warnAboutWebextensionVersion("Firefox's Browsh webextension is from Browsh v" +
+			hello.BrowshVersion + ", but this is v" + browshVersion +
+			". Please reinstall Browsh.")
+		return
+	}
+	slog.Info("Webextension protocol matches", "version", protocolVersion)
+}
+
+// Webextensions from before the protocol was versioned never send a hello, only messages
+// that aren't JSON
+func warnAboutUnknownMessage(raw []byte) {
+	warnAboutUnknownMessagesOnce.Do(func() {
+		warnAboutWebextensionVersion("Firefox's Browsh webextension is from an older " +
+			"version of Browsh. Please reinstall Browsh.")
+	})
+	slog.Info("WEBEXT", "unknown", string(raw))
+}
+
+func warnAboutWebextensionVersion(message string) {
+	slog.Error(message)
+	showConnectionStatus(message)
+}
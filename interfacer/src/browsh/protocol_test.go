@@ -0,0 +1,78 @@
+package browsh
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/spf13/viper"
+)
+
+func TestProtocol(t *testing.T) {
+	RegisterFailHandler(Fail)
+}
+
+var _ = Describe("Webextension protocol", func() {
+	AfterEach(func() {
+		viper.Set("http-server-mode", false)
+		viper.Set("http-server.api-keys", nil)
+	})
+
+	It("should keep commas in payloads", func() {
+		url := "https://www.brow.sh/?a=1,2,3"
+		message := newWebextensionMessage("/new_tab", newTabPayload{URL: url})
+		decoded, err := decodeWebextensionMessage([]byte(message.encode()))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(decoded.Version).To(Equal(protocolVersion))
+		Expect(decoded.Command).To(Equal("/new_tab"))
+		var payload newTabPayload
+		Expect(decoded.decodePayload(&payload)).To(BeTrue())
+		Expect(payload.URL).To(Equal(url))
+	})
+
+	It("should only include a tab ID and correlation ID when there is one", func() {
+		Expect(newTabMessage("/remove_tab", 3, nil).encode()).To(Equal(
+			`{"version":1,"command":"/remove_tab","tab_id":3}`))
+		Expect(newCorrelatedMessage("/raw_text_abort", "abc", nil).encode()).To(Equal(
+			`{"version":1,"command":"/raw_text_abort","correlation_id":"abc"}`))
+	})
+
+	It("should give tab commands a typed payload", func() {
+		message := newTabMessage("/tab_command", 3, tabCommandPayload{
+			Command: "/scroll_status",
+			Payload: scrollStatusPayload{X: 1, Y: 2},
+		})
+		Expect(message.encode()).To(Equal(`{"version":1,"command":"/tab_command","tab_id":3,` +
+			`"payload":{"command":"/scroll_status","payload":{"x":1,"y":2}}}`))
+	})
+
+	It("should send the config as the payload itself", func() {
+		viper.Set("http-server.api-keys", []string{"secret"})
+		var config map[string]interface{}
+		Expect(json.Unmarshal(newConfigMessage().Payload, &config)).To(Succeed())
+		Expect(config).To(HaveKey("http-server"))
+		Expect(config["http-server"]).ToNot(HaveKey("api-keys"))
+	})
+
+	It("should give raw text to the request with the same correlation ID", func() {
+		viper.Set("http-server-mode", true)
+		request := rawTextRequests.add(nil)
+		go handleWebextensionCommand([]byte(
+			`{"version":1,"command":"/raw_text","correlation_id":"` + request.ID +
+				`","payload":{"page_load_duration":10}}`))
+		response, err := waitForRawText(context.Background(), request, 1)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(response).To(Equal(`{"page_load_duration":10}`))
+	})
+
+	It("should cope with messages from webextensions before the protocol", func() {
+		Expect(func() {
+			handleWebextensionCommand([]byte("/raw_text,{}"))
+		}).ToNot(Panic())
+		Expect(func() {
+			checkWebextensionVersion(helloPayload{ProtocolVersion: 0})
+		}).ToNot(Panic())
+	})
+})
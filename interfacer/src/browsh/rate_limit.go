@@ -0,0 +1,140 @@
+package browsh
+
+import (
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-errors/errors"
+	"github.com/go-redis/redis"
+	"github.com/spf13/viper"
+	"github.com/ulule/limiter"
+	"github.com/ulule/limiter/drivers/store/memory"
+	redisstore "github.com/ulule/limiter/drivers/store/redis"
+)
+
+const rateLimitPrefix = "browsh_rate_limit"
+
+// Requests are counted per IP address, apart from those made with an API key that has
+// its own rate limit, which are counted per key. Keys' rate limits are read from the
+// key itself on every request, as keys in `http-server.api-keys-file` can change
+// without a restart.
+type rateLimiter struct {
+	store limiter.Store
+	rate  limiter.Rate
+}
+
+func setupRateLimiter() *rateLimiter {
+	rateLimiter, err := newRateLimiter()
+	if err != nil {
+		Shutdown(err)
+	}
+	return rateLimiter
+}
+
+func newRateLimiter() (*rateLimiter, error) {
+	rate, err := limiter.NewRateFromFormatted(viper.GetString("http-server.rate-limit"))
+	if err != nil {
+		return nil, err
+	}
+	store, err := newRateLimitStore()
+	if err != nil {
+		return nil, err
+	}
+	// Mistakes in the keys that Browsh starts with are caught straight away
+	for _, key := range getAPIKeys() {
+		if key.RateLimit == "" {
+			continue
+		}
+		if _, err := limiter.NewRateFromFormatted(key.RateLimit); err != nil {
+			return nil, err
+		}
+	}
+	return &rateLimiter{store: store, rate: rate}, nil
+}
+
+// The in-memory store only knows about requests to this instance. Instances behind a
+// load balancer should share a Redis store, or anything else that speaks the Redis
+// protocol.
+func newRateLimitStore() (limiter.Store, error) {
+	switch viper.GetString("http-server.rate-limit-store") {
+	case "", "memory":
+		return memory.NewStoreWithOptions(limiter.StoreOptions{
+			Prefix:          rateLimitPrefix,
+			CleanUpInterval: limiter.DefaultCleanUpInterval,
+		}), nil
+	case "redis":
+		options, err := redis.ParseURL(viper.GetString("http-server.rate-limit-redis-url"))
+		if err != nil {
+			return nil, err
+		}
+		return redisstore.NewStoreWithOptions(redis.NewClient(options), limiter.StoreOptions{
+			Prefix:   rateLimitPrefix,
+			MaxRetry: limiter.DefaultMaxRetry,
+		})
+	}
+	return nil, errors.New(
+		"Unknown http-server.rate-limit-store: " + viper.GetString("http-server.rate-limit-store"))
+}
+
+func (l *rateLimiter) Handler(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r, key, rate := l.identify(r)
+		context, err := l.store.Get(r.Context(), key, rate)
+		if err != nil {
+			slog.Error("Rate limit store failed", "error", err)
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+		setRateLimitHeaders(w, context)
+		if context.Reached {
+			metricRateLimited.Inc()
+			setRequestRejection(r, rejectedRateLimit)
+			http.Error(w, "Limit exceeded", http.StatusTooManyRequests)
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+func (l *rateLimiter) identify(r *http.Request) (*http.Request, string, limiter.Rate) {
+	r, key := resolveAPIKey(r)
+	if key == nil || key.RateLimit == "" {
+		return r, "ip:" + getClientIP(r), l.rate
+	}
+	rate, err := limiter.NewRateFromFormatted(key.RateLimit)
+	if err != nil {
+		// Only possible for keys from the keys file that were changed after startup
+		slog.Error("Invalid rate limit for API key", "key", hashAPIKey(key.Key), "error", err)
+		return r, "ip:" + getClientIP(r), l.rate
+	}
+	return r, "key:" + hashAPIKey(key.Key), rate
+}
+
+// Browsh is usually behind a proxy or load balancer, so the client is the first address
+// in "X-Forwarded-For" when there is one
+func getClientIP(r *http.Request) string {
+	return limiter.GetIPKey(r, true)
+}
+
+// The `RateLimit-*` headers follow the IETF draft, where the reset is the number of
+// seconds until the limit resets. The older `X-RateLimit-*` headers are kept for
+// existing clients, their reset is a Unix timestamp.
+func setRateLimitHeaders(w http.ResponseWriter, context limiter.Context) {
+	resetIn := context.Reset - time.Now().Unix()
+	if resetIn < 0 {
+		resetIn = 0
+	}
+	limit := strconv.FormatInt(context.Limit, 10)
+	remaining := strconv.FormatInt(context.Remaining, 10)
+	w.Header().Set("RateLimit-Limit", limit)
+	w.Header().Set("RateLimit-Remaining", remaining)
+	w.Header().Set("RateLimit-Reset", strconv.FormatInt(resetIn, 10))
+	w.Header().Set("X-RateLimit-Limit", limit)
+	w.Header().Set("X-RateLimit-Remaining", remaining)
+	w.Header().Set("X-RateLimit-Reset", strconv.FormatInt(context.Reset, 10))
+	if context.Reached {
+		w.Header().Set("Retry-After", strconv.FormatInt(resetIn, 10))
+	}
+}
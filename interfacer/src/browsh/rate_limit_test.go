@@ -0,0 +1,118 @@
+package browsh
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/spf13/viper"
+)
+
+func TestRateLimit(t *testing.T) {
+	RegisterFailHandler(Fail)
+}
+
+var _ = Describe("Rate limiting", func() {
+	var handler http.Handler
+
+	request := func(apiKey string) *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		request := httptest.NewRequest("GET", "/", nil)
+		if apiKey != "" {
+			request.Header.Set(apiKeyHeader, apiKey)
+		}
+		handler.ServeHTTP(recorder, request)
+		return recorder
+	}
+
+	setup := func() {
+		rateLimiter, err := newRateLimiter()
+		Expect(err).ToNot(HaveOccurred())
+		handler = rateLimiter.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	}
+
+	BeforeEach(func() {
+		viper.Set("http-server.rate-limit", "2-M")
+		viper.Set("http-server.rate-limit-store", "memory")
+		viper.Set("http-server.api-keys", []map[string]interface{}{
+			{"key": "generous", "rate-limit": "5-M"},
+		})
+	})
+
+	AfterEach(func() {
+		viper.Set("http-server.rate-limit", "100000000-M")
+		viper.Set("http-server.rate-limit-store", "memory")
+		viper.Set("http-server.api-keys", nil)
+		viper.Set("http-server.api-keys-file", "")
+	})
+
+	It("should send the standard headers", func() {
+		setup()
+		response := request("")
+		Expect(response.Code).To(Equal(http.StatusOK))
+		Expect(response.Header().Get("RateLimit-Limit")).To(Equal("2"))
+		Expect(response.Header().Get("RateLimit-Remaining")).To(Equal("1"))
+		Expect(response.Header().Get("RateLimit-Reset")).ToNot(BeEmpty())
+	})
+
+	It("should ask clients to retry once the limit is reached", func() {
+		setup()
+		request("")
+		request("")
+		response := request("")
+		Expect(response.Code).To(Equal(http.StatusTooManyRequests))
+		Expect(response.Header().Get("Retry-After")).ToNot(BeEmpty())
+	})
+
+	It("should count API keys separately with their own limit", func() {
+		setup()
+		request("")
+		request("")
+		response := request("generous")
+		Expect(response.Code).To(Equal(http.StatusOK))
+		Expect(response.Header().Get("RateLimit-Limit")).To(Equal("5"))
+	})
+
+	It("should use the limits of keys added to the keys file after starting", func() {
+		setup()
+		dir, _ := os.MkdirTemp("", "browsh-keys")
+		defer os.RemoveAll(dir)
+		path := filepath.Join(dir, "keys.toml")
+		os.WriteFile(path, []byte("[[api-keys]]\nkey = \"new\"\nrate-limit = \"7-M\"\n"), 0o600)
+		viper.Set("http-server.api-keys-file", path)
+		response := request("new")
+		Expect(response.Header().Get("RateLimit-Limit")).To(Equal("7"))
+	})
+
+	It("should count unknown API keys by IP address", func() {
+		setup()
+		request("")
+		request("")
+		Expect(request("made-up").Code).To(Equal(http.StatusTooManyRequests))
+	})
+
+	It("should share counts through Redis", func() {
+		server, err := miniredis.Run()
+		Expect(err).ToNot(HaveOccurred())
+		defer server.Close()
+		viper.Set("http-server.rate-limit-store", "redis")
+		viper.Set("http-server.rate-limit-redis-url", "redis://"+server.Addr()+"/0")
+		setup()
+		request("")
+		// A second instance sharing the same Redis
+		setup()
+		request("")
+		Expect(request("").Code).To(Equal(http.StatusTooManyRequests))
+	})
+
+	It("should reject unknown stores", func() {
+		viper.Set("http-server.rate-limit-store", "carrier-pigeon")
+		_, err := newRateLimiter()
+		Expect(err).To(HaveOccurred())
+	})
+})
@@ -1,6 +1,7 @@
 package browsh
 
 import (
+	"context"
 	"crypto/rand"
 	"encoding/json"
 	"fmt"
@@ -14,50 +15,165 @@ import (
 	"time"
 
 	"github.com/NYTimes/gziphandler"
+	"github.com/go-errors/errors"
 	"github.com/spf13/viper"
-	"github.com/ulule/limiter"
-	"github.com/ulule/limiter/drivers/middleware/stdlib"
-	"github.com/ulule/limiter/drivers/store/memory"
 )
 
 // In order to communicate between the incoming HTTP request and the websocket request to the
 // real browser to render the webpage, we keep track of requests in a map.
-var rawTextRequests = newRequestsMap()
+var (
+	rawTextRequests   = newRequestsMap()
+	errRawTextTimeout = errors.New("raw text request timed out")
+)
+
+// A render that is waiting on the webextension. The result channel is signalled
+// exactly once, when the webextension sends back the parsed text or gives up on the page.
+type rawTextRequest struct {
+	ID     string
+	start  time.Time
+	result chan rawTextResult
+	// The pooled Firefox that is rendering the page, if there's a pool
+	browser *firefoxInstance
+}
+
+type rawTextResult struct {
+	response string
+	err      error
+}
 
 type threadSafeRequestsMap struct {
 	sync.RWMutex
-	internal map[string]string
+	internal map[string]*rawTextRequest
 }
 
 func newRequestsMap() *threadSafeRequestsMap {
 	return &threadSafeRequestsMap{
-		internal: make(map[string]string),
+		internal: make(map[string]*rawTextRequest),
 	}
 }
 
-func (m *threadSafeRequestsMap) load(key string) (value string, ok bool) {
-	m.RLock()
-	result, ok := m.internal[key]
-	m.RUnlock()
-	return result, ok
+func (m *threadSafeRequestsMap) add(browser *firefoxInstance) *rawTextRequest {
+	request := &rawTextRequest{
+		ID:      pseudoUUID(),
+		browser: browser,
+		start:   time.Now(),
+		// Buffered so that the websocket reader never blocks on a request that is just
+		// about to give up waiting.
+		result: make(chan rawTextResult, 1),
+	}
+	m.Lock()
+	m.internal[request.ID] = request
+	m.Unlock()
+	return request
 }
 
-func (m *threadSafeRequestsMap) store(key string, value string) {
+func (m *threadSafeRequestsMap) remove(key string) {
 	m.Lock()
-	m.internal[key] = value
+	delete(m.internal, key)
 	m.Unlock()
 }
 
-func (m *threadSafeRequestsMap) remove(key string) {
+// Hand the webextension's response to whoever is waiting for it. Returns false when
+// nothing is waiting, for example when the request already timed out.
+func (m *threadSafeRequestsMap) resolve(key string, response string) bool {
+	return m.finish(key, rawTextResult{response: response})
+}
+
+// For when the webextension couldn't render the page at all
+func (m *threadSafeRequestsMap) reject(key string, err error) bool {
+	return m.finish(key, rawTextResult{err: err})
+}
+
+// For when a pooled browser's webextension goes away in the middle of its renders
+func (m *threadSafeRequestsMap) rejectBrowser(browser *firefoxInstance, err error) {
+	var rejected []*rawTextRequest
+	m.Lock()
+	for key, request := range m.internal {
+		if request.browser == browser {
+			rejected = append(rejected, request)
+			delete(m.internal, key)
+		}
+	}
+	m.Unlock()
+	for _, request := range rejected {
+		request.result <- rawTextResult{err: err}
+	}
+}
+
+func (m *threadSafeRequestsMap) finish(key string, result rawTextResult) bool {
 	m.Lock()
+	request, ok := m.internal[key]
 	delete(m.internal, key)
 	m.Unlock()
+	if ok {
+		request.result <- result
+	}
+	return ok
+}
+
+// The elapsed time in milliseconds since the request was dispatched
+func (r *rawTextRequest) totalDuration() int {
+	return int(time.Since(r.start) / time.Millisecond)
+}
+
+// Overrides of the global `[http-server]` config for a single render. Zero values mean
+// that the config value is used instead. The JSON names match the config keys so that
+// the webextension can simply merge them over its own copy of the config.
+type rawTextOptions struct {
+	Columns         int     `json:"columns,omitempty"`
+	Rows            int     `json:"rows,omitempty"`
+	RenderDelay     int     `json:"render_delay,omitempty"`
+	Timeout         int     `json:"timeout,omitempty"`
+	JpegCompression float64 `json:"jpeg_compression,omitempty"`
+	// A pointer so that a client can turn off footnotes that the config turns on
+	LinkFootnotes *bool `json:"link_footnotes,omitempty"`
+	// Set from the request's API key, never by the client, see `allowedDomainsForRequest()`
+	AllowedDomains []string `json:"allowed_domains,omitempty"`
+}
+
+type outgoingRawTextRequest struct {
+	Mode    string         `json:"mode"`
+	URL     string         `json:"url"`
+	Options rawTextOptions `json:"options"`
+}
+
+type rawTextLink struct {
+	Text     string               `json:"text"`
+	Href     string               `json:"href"`
+	Position *rawTextLinkPosition `json:"position,omitempty"`
+}
+
+// Where a link was rendered, in the same character cells as PLAIN mode's text. Links
+// that weren't visible on the page don't have a position.
+type rawTextLinkPosition struct {
+	Column int `json:"column"`
+	Row    int `json:"row"`
+	Width  int `json:"width"`
+	Height int `json:"height"`
+}
+
+// The body of a 'LINKS' mode response
+type rawTextLinksResponse struct {
+	Title string        `json:"title"`
+	URL   string        `json:"url"`
+	Links []rawTextLink `json:"links"`
 }
 
 type rawTextResponse struct {
-	PageloadDuration int    `json:"page_load_duration"`
-	ParsingDuration  int    `json:"parsing_duration"`
-	Text             string `json:"body"`
+	PageloadDuration int           `json:"page_load_duration"`
+	ParsingDuration  int           `json:"parsing_duration"`
+	Text             string        `json:"body"`
+	Title            string        `json:"title"`
+	URL              string        `json:"url"`
+	Links            []rawTextLink `json:"links"`
+}
+
+// The timeout in seconds for a render
+func (o rawTextOptions) timeout() int {
+	if o.Timeout > 0 {
+		return o.Timeout
+	}
+	return viper.GetInt("http-server.timeout")
 }
 
 // HTTPServerStart starts the HTTP server is a seperate service from the usual interactive TTY
@@ -68,6 +184,10 @@ type rawTextResponse struct {
 // `Something                                                                    `
 func HTTPServerStart() {
 	IsHTTPServerMode = true
+	isServerHandlingSignals = true
+	setupRenderCache()
+	setupRenderQueue()
+	setupAccessLog()
 	StartFirefox()
 	go startWebSocketServer()
 	slog.Info("Starting Browsh HTTP server")
@@ -76,21 +196,25 @@ func HTTPServerStart() {
 	serverMux := http.NewServeMux()
 	uncompressed := http.HandlerFunc(handleHTTPServerRequest)
 	limiterMiddleware := setupRateLimiter()
-	serverMux.Handle("/", limiterMiddleware.Handler(gziphandler.GzipHandler(uncompressed)))
-	if err := http.ListenAndServe(bind+":"+port, &slashFix{serverMux}); err != nil {
-		Shutdown(err)
-	}
-}
-
-func setupRateLimiter() *stdlib.Middleware {
-	rate, err := limiter.NewRateFromFormatted(viper.GetString("http-server.rate-limit"))
-	if err != nil {
-		Shutdown(err)
+	serverMux.Handle("/", instrument(limiterMiddleware.Handler(
+		authenticate(gziphandler.GzipHandler(uncompressed)))))
+	api := http.HandlerFunc(handleAPIRenderRequest)
+	serverMux.Handle(apiRenderPath, instrument(limiterMiddleware.Handler(
+		authenticate(gziphandler.GzipHandler(api)))))
+	purge := http.HandlerFunc(handleAPIPurgeRequest)
+	serverMux.Handle(apiPurgePath, instrument(limiterMiddleware.Handler(
+		authenticate(requireAdmin(purge)))))
+	// Health checks are for load balancers and orchestrators, so they don't need API keys
+	serverMux.HandleFunc(healthPath, handleHealthRequest)
+	serverMux.HandleFunc(readinessPath, handleReadinessRequest)
+	if viper.GetBool("http-server.metrics") {
+		// Not rate limited, so that frequent scrapes can't lock out real clients
+		serverMux.Handle(metricsPath, authenticate(metricsHandler()))
 	}
-	// TODO: Centralise store amongst instances with Redis
-	store := memory.NewStore()
-	middleware := stdlib.NewMiddleware(limiter.New(store, rate), stdlib.WithForwardHeader(true))
-	return middleware
+	serveUntilSignalled(&http.Server{
+		Addr:    bind + ":" + port,
+		Handler: &slashFix{serverMux},
+	})
 }
 
 func pseudoUUID() (uuid string) {
@@ -113,7 +237,14 @@ type slashFix struct {
 // https://domain.com/http://anotherdomain.com
 // So here is a little hack that simply escapes the entire path portion to make sure it gets
 // through the router unchanged.
+//
+// The versioned API, metrics and health checks live outside of this scheme, so they're
+// routed as normal.
 func (h *slashFix) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if isAPIPath(r.URL.Path) || isOperationsPath(r.URL.Path) {
+		h.mux.ServeHTTP(w, r)
+		return
+	}
 	r.URL.Path = "/" + url.PathEscape(strings.TrimPrefix(r.URL.RequestURI(), "/"))
 	h.mux.ServeHTTP(w, r)
 }
@@ -121,7 +252,6 @@ func (h *slashFix) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 func handleHTTPServerRequest(w http.ResponseWriter, r *http.Request) {
 	var message string
 	var isErrored bool
-	start := time.Now().Format(time.RFC3339)
 	urlForBrowsh, _ := url.PathUnescape(strings.TrimPrefix(r.URL.Path, "/"))
 	urlForBrowsh, isErrored = deRecurseURL(urlForBrowsh)
 	if isErrored {
@@ -129,28 +259,33 @@ func handleHTTPServerRequest(w http.ResponseWriter, r *http.Request) {
 		io.WriteString(w, message)
 		return
 	}
-	if isProductionHTTP(r) {
-		http.Redirect(w, r, "https://"+r.Host+"/"+urlForBrowsh, 301)
+	if shouldRedirectToHTTPS(r) {
+		http.Redirect(w, r, getHTTPSURL(r), 301)
 		return
 	}
 	if urlForBrowsh == "favicon.ico" {
 		http.Redirect(w, r, "https://www.brow.sh/assets/favicon-16x16.png", 301)
 		return
 	}
+	mode := getRawTextMode(r)
+	setRequestTarget(r, urlForBrowsh, mode)
 	w.Header().Set("Cache-Control", "public, max-age=600")
 	if isDisallowedDomain(urlForBrowsh) {
+		blockRequest(r, blockedDomain)
 		http.Redirect(w, r, "/", 301)
 		return
 	}
 	if isDisallowedUserAgent(r.Header.Get("User-Agent")) {
 		if urlForBrowsh != "" {
+			blockRequest(r, blockedUserAgent)
 			http.Redirect(w, r, "/", 403)
 			return
 		}
 	}
 	slog.Info("Handling request", "User-Agent", r.Header.Get("User-Agent"))
+	// Older deployments check readiness at the root URL
 	if isKubeReadinessProbe(r.Header.Get("User-Agent")) {
-		io.WriteString(w, "healthy")
+		handleReadinessRequest(w, r)
 		return
 	}
 	if strings.TrimSpace(urlForBrowsh) == "" {
@@ -161,6 +296,13 @@ func handleHTTPServerRequest(w http.ResponseWriter, r *http.Request) {
 			io.WriteString(w, message)
 			return
 		}
+		if strings.HasPrefix(r.Host, "md.") {
+			message = "Welcome to the Browsh Markdown client.\n" +
+				"You can use it by appending URLs like this;\n" +
+				"https://md.brow.sh/https://www.brow.sh"
+			io.WriteString(w, message)
+			return
+		}
 		urlForBrowsh = "https://www.brow.sh/html-service-welcome"
 	}
 	if urlForBrowsh == "robots.txt" {
@@ -168,14 +310,134 @@ func handleHTTPServerRequest(w http.ResponseWriter, r *http.Request) {
 		io.WriteString(w, message)
 		return
 	}
-	rawTextRequestID := pseudoUUID()
-	rawTextRequests.store(rawTextRequestID+"-start", start)
-	mode := getRawTextMode(r)
-	sendMessageToWebExtension(
-		"/raw_text_request," + rawTextRequestID + "," +
-			mode + "," +
-			urlForBrowsh)
-	waitForResponse(rawTextRequestID, w)
+	urlForBrowsh, options, err := getRawTextOptions(r, urlForBrowsh)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	setRequestTarget(r, urlForBrowsh, mode)
+	if !isURLAllowedForRequest(r, urlForBrowsh) {
+		blockRequest(r, blockedAPIKey)
+		http.Error(w, "This API key can't render "+urlForBrowsh, http.StatusForbidden)
+		return
+	}
+	options.AllowedDomains = allowedDomainsForRequest(r)
+	render, isCached, err := renderPage(r.Context(), urlForBrowsh, mode, options)
+	if errors.Is(err, errDisallowedDestination) {
+		blockRequest(r, blockedDestination)
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	if errors.Is(err, errDisallowedByAPIKey) {
+		blockRequest(r, blockedAPIKey)
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	if isRenderQueueError(err) {
+		blockRequest(r, blockedQueueFull)
+		w.Header().Set("Retry-After", renderQueue.retryAfter())
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	if errors.Is(err, errNoBrowserConnected) {
+		blockRequest(r, blockedNoBrowser)
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	if errors.Is(err, errRawTextTimeout) {
+		io.WriteString(w, rawTextTimeoutMessage(options.timeout()))
+		return
+	}
+	if errors.Is(err, context.Canceled) {
+		slog.Info("Client went away before the render finished", "url", urlForBrowsh)
+		return
+	}
+	if err != nil {
+		slog.Error("Couldn't render page", "url", urlForBrowsh, "error", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	setRequestRender(r, render, isCached)
+	sendResponse(render, isCached, w, r)
+}
+
+// Render a page with Firefox, or reuse a recent render of it from the cache. Returns
+// whether the render came from the cache.
+func renderPage(
+	ctx context.Context,
+	urlForBrowsh, mode string,
+	options rawTextOptions,
+) (*cachedRender, bool, error) {
+	// Checked even for cached renders, in case the destination has since been blocked
+	if err := checkDestination(ctx, urlForBrowsh); err != nil {
+		return nil, false, err
+	}
+	key := renderCacheKey(urlForBrowsh, mode, options)
+	if renderCache != nil {
+		if render, ok := renderCache.get(key); ok {
+			metricCacheLookups.WithLabelValues("hit").Inc()
+			return render, true, nil
+		}
+		metricCacheLookups.WithLabelValues("miss").Inc()
+	}
+	if err := renderQueue.start(ctx); err != nil {
+		return nil, false, err
+	}
+	defer renderQueue.done()
+	request, err := dispatchRawTextRequest(urlForBrowsh, mode, options)
+	if err != nil {
+		return nil, false, err
+	}
+	response, err := waitForRawText(ctx, request, options.timeout())
+	if err != nil {
+		return nil, false, err
+	}
+	render := newCachedRender(urlForBrowsh, mode, response, request.totalDuration())
+	observeRender(render.TotalDuration, unpackResponse(response))
+	if renderCache != nil {
+		renderCache.set(key, render)
+	}
+	return render, false, nil
+}
+
+// Ask the webextension to load and parse a URL. The returned request is used to collect
+// the parsed result once the webextension sends it back.
+func dispatchRawTextRequest(
+	urlForBrowsh, mode string,
+	options rawTextOptions,
+) (*rawTextRequest, error) {
+	browser, err := browserPool.acquire()
+	if err != nil {
+		return nil, err
+	}
+	request := rawTextRequests.add(browser)
+	request.sendToBrowser(newCorrelatedMessage("/raw_text_request", request.ID,
+		outgoingRawTextRequest{
+			Mode:    mode,
+			URL:     urlForBrowsh,
+			Options: options,
+		}))
+	return request, nil
+}
+
+// Let the webextension know that nobody is waiting for a render anymore, so it can close
+// the tab rather than carry on loading the page.
+func abortRawTextRequest(request *rawTextRequest) {
+	rawTextRequests.remove(request.ID)
+	request.sendToBrowser(newCorrelatedMessage("/raw_text_abort", request.ID, nil))
+}
+
+// The single Firefox's webextension never connects when there's a pool
+func (r *rawTextRequest) sendToBrowser(message webextensionMessage) {
+	if r.browser != nil {
+		r.browser.send(message)
+		return
+	}
+	if browserPool != nil {
+		slog.Error("Render isn't using a pooled browser. Message not sent", "command", message.Command)
+		return
+	}
+	sendMessageToWebExtension(message)
 }
 
 // Prevent https://html.brow.sh/html.brow.sh/... being recursive
@@ -184,7 +446,9 @@ func deRecurseURL(urlForBrowsh string) (string, bool) {
 	if err != nil {
 		return urlForBrowsh, false
 	}
-	if nestedURL.Host != "html.brow.sh" && nestedURL.Host != "text.brow.sh" {
+	switch nestedURL.Host {
+	case "html.brow.sh", "text.brow.sh", "md.brow.sh":
+	default:
 		return urlForBrowsh, false
 	}
 	return deRecurseURL(strings.TrimPrefix(nestedURL.RequestURI(), "/"))
@@ -210,17 +474,18 @@ func isDisallowedUserAgent(userAgent string) bool {
 	return false
 }
 
-func isKubeReadinessProbe(userAgent string) bool {
-	r, _ := regexp.Compile("GoogleHC")
-	if r.MatchString(userAgent) {
+func isOperationsPath(path string) bool {
+	switch path {
+	case metricsPath, healthPath, readinessPath:
 		return true
 	}
 	return false
 }
 
-func isProductionHTTP(r *http.Request) bool {
-	if strings.Contains(r.Host, "brow.sh") {
-		return r.Header.Get("X-Forwarded-Proto") == "http"
+func isKubeReadinessProbe(userAgent string) bool {
+	r, _ := regexp.Compile("GoogleHC")
+	if r.MatchString(userAgent) {
+		return true
 	}
 	return false
 }
@@ -228,52 +493,116 @@ func isProductionHTTP(r *http.Request) bool {
 // 'PLAIN' mode returns raw text without any HTML whatsoever.
 // 'HTML' mode returns some basic HTML tags for things like anchor links.
 // 'DOM' mode returns a simple dump of the DOM.
+// 'MARKDOWN' mode converts the DOM's headings, links, lists, code and tables to Markdown.
+// 'READER' mode returns plain text of just the page's main article.
+// 'LINKS' mode returns JSON of every link on the page and where it was rendered.
 func getRawTextMode(r *http.Request) string {
 	mode := "HTML"
 	if strings.Contains(r.Host, "text.") {
 		mode = "PLAIN"
 	}
+	if strings.HasPrefix(r.Host, "md.") {
+		mode = "MARKDOWN"
+	}
 	if r.Header.Get("X-Browsh-Raw-Mode") == "PLAIN" {
 		mode = "PLAIN"
 	}
 	if r.Header.Get("X-Browsh-Raw-Mode") == "DOM" {
 		mode = "DOM"
 	}
+	if r.Header.Get("X-Browsh-Raw-Mode") == "MARKDOWN" {
+		mode = "MARKDOWN"
+	}
+	if r.Header.Get("X-Browsh-Raw-Mode") == "READER" {
+		mode = "READER"
+	}
+	if r.Header.Get("X-Browsh-Raw-Mode") == "LINKS" {
+		mode = "LINKS"
+	}
 	return mode
 }
 
-func waitForResponse(rawTextRequestID string, w http.ResponseWriter) {
-	var rawTextRequestResponse string
-	var ok bool
-	isSent := false
-	maxTime := time.Duration(viper.GetInt("http-server.timeout")) * time.Second
-	start := time.Now()
-	for time.Since(start) < maxTime {
-		if rawTextRequestResponse, ok = rawTextRequests.load(rawTextRequestID); ok {
-			sendResponse(rawTextRequestResponse, rawTextRequestID, w)
-			isSent = true
-			break
-		}
-		time.Sleep(1 * time.Millisecond)
+func isValidRawTextMode(mode string) bool {
+	switch mode {
+	case "PLAIN", "HTML", "DOM", "MARKDOWN", "READER", "LINKS":
+		return true
 	}
-	rawTextRequests.remove(rawTextRequestID)
-	if !isSent {
-		timeout := viper.GetInt("http-server.timeout")
-		message := fmt.Sprintf("Browsh rendering aborted after %ds timeout.", timeout)
-		io.WriteString(w, message)
+	return false
+}
+
+// Block until the webextension has sent back the parsed text for the given request, the
+// timeout, in seconds, is reached or the context is cancelled, say by the HTTP client
+// disconnecting.
+func waitForRawText(ctx context.Context, request *rawTextRequest, timeout int) (string, error) {
+	timer := time.NewTimer(time.Duration(timeout) * time.Second)
+	defer timer.Stop()
+	defer browserPool.release(request.browser)
+	select {
+	case result := <-request.result:
+		return result.response, result.err
+	case <-timer.C:
+		metricRenderTimeouts.Inc()
+		abortRawTextRequest(request)
+		return "", errRawTextTimeout
+	case <-ctx.Done():
+		abortRawTextRequest(request)
+		return "", ctx.Err()
 	}
 }
 
-func sendResponse(response, rawTextRequestID string, w http.ResponseWriter) {
-	jsonResponse := unpackResponse(response)
-	requestStart, _ := rawTextRequests.load(rawTextRequestID + "-start")
-	totalTime := getTotalTiming(requestStart)
+func rawTextTimeoutMessage(timeout int) string {
+	return fmt.Sprintf("Browsh rendering aborted after %ds timeout.", timeout)
+}
+
+// Cached renders keep the timings of when they were originally rendered
+func sendResponse(render *cachedRender, isCached bool, w http.ResponseWriter, r *http.Request) {
+	jsonResponse := unpackResponse(render.Response)
+	totalTime := fmt.Sprintf("%d", render.TotalDuration)
 	pageLoad := fmt.Sprintf("%d", jsonResponse.PageloadDuration)
 	parsing := fmt.Sprintf("%d", jsonResponse.ParsingDuration)
 	w.Header().Set("X-Browsh-Duration-Total", totalTime)
 	w.Header().Set("X-Browsh-Duration-Pageload", pageLoad)
 	w.Header().Set("X-Browsh-Duration-Parsing", parsing)
-	io.WriteString(w, jsonResponse.Text)
+	w.Header().Set("ETag", render.ETag)
+	if renderCache != nil {
+		w.Header().Set("X-Browsh-Cache", cacheStatus(isCached))
+	}
+	if isETagMatch(r.Header.Get("If-None-Match"), render.ETag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	switch render.Mode {
+	case "MARKDOWN":
+		w.Header().Set("Content-Type", "text/markdown; charset=utf-8")
+	case "LINKS":
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	}
+	io.WriteString(w, rawTextBody(jsonResponse, render.Mode))
+}
+
+func cacheStatus(isCached bool) string {
+	if isCached {
+		return "HIT"
+	}
+	return "MISS"
+}
+
+// The text to give back to the client for a render. 'LINKS' mode doesn't have any text
+// as such, just the links themselves.
+func rawTextBody(response rawTextResponse, mode string) string {
+	if mode != "LINKS" {
+		return response.Text
+	}
+	links := response.Links
+	if links == nil {
+		links = []rawTextLink{}
+	}
+	body, _ := json.Marshal(rawTextLinksResponse{
+		Title: response.Title,
+		URL:   response.URL,
+		Links: links,
+	})
+	return string(body)
 }
 
 func unpackResponse(jsonString string) rawTextResponse {
@@ -283,9 +612,3 @@ func unpackResponse(jsonString string) rawTextResponse {
 	}
 	return response
 }
-
-func getTotalTiming(startString string) string {
-	start, _ := time.Parse(time.RFC3339, startString)
-	elapsed := time.Since(start) / time.Millisecond
-	return fmt.Sprintf("%d", elapsed)
-}
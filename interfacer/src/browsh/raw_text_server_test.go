@@ -1,16 +1,41 @@
 package browsh
 
 import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
 	"testing"
 
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
+	"github.com/spf13/viper"
 )
 
 func TestRawTextServer(t *testing.T) {
 	RegisterFailHandler(Fail)
 }
 
+// Pretends that the webextension failed every render that's waiting, once there is one
+func rejectWaitingRenders(err error) {
+	waiting := func() []string {
+		rawTextRequests.RLock()
+		defer rawTextRequests.RUnlock()
+		var ids []string
+		for id := range rawTextRequests.internal {
+			ids = append(ids, id)
+		}
+		return ids
+	}
+	go func() {
+		defer GinkgoRecover()
+		Eventually(waiting).ShouldNot(BeEmpty())
+		for _, id := range waiting() {
+			rawTextRequests.reject(id, err)
+		}
+	}()
+}
+
 var _ = Describe("Raw text server", func() {
 	Describe("De-recursing URLs", func() {
 		It("should not do anything to normal URLs", func() {
@@ -34,5 +59,94 @@ var _ = Describe("Raw text server", func() {
 			url, _ := deRecurseURL(testURL)
 			Expect(url).To(Equal(google))
 		})
+		It("should de-recurse the Markdown service", func() {
+			url, _ := deRecurseURL("https://md.brow.sh/https://example.com")
+			Expect(url).To(Equal("https://example.com"))
+		})
+	})
+
+	Describe("Choosing the raw text mode", func() {
+		It("should default to HTML", func() {
+			request := httptest.NewRequest("GET", "http://localhost/", nil)
+			Expect(getRawTextMode(request)).To(Equal("HTML"))
+		})
+		It("should use Markdown for the md. host", func() {
+			request := httptest.NewRequest("GET", "http://md.brow.sh/", nil)
+			Expect(getRawTextMode(request)).To(Equal("MARKDOWN"))
+		})
+		It("should use Markdown when asked for in the header", func() {
+			request := httptest.NewRequest("GET", "http://localhost/", nil)
+			request.Header.Set("X-Browsh-Raw-Mode", "MARKDOWN")
+			Expect(getRawTextMode(request)).To(Equal("MARKDOWN"))
+		})
+		It("should use reader mode when asked for in the header", func() {
+			request := httptest.NewRequest("GET", "http://localhost/", nil)
+			request.Header.Set("X-Browsh-Raw-Mode", "READER")
+			Expect(getRawTextMode(request)).To(Equal("READER"))
+		})
+	})
+
+	Describe("Handling requests", func() {
+		It("should answer with an error when the render fails", func() {
+			viper.Set("http-server.timeout", 5)
+			defer viper.Set("http-server.timeout", 0)
+			rejectWaitingRenders(errors.New("The webextension couldn't render the page"))
+			recorder := httptest.NewRecorder()
+			request := httptest.NewRequest("GET", "http://localhost/https://www.brow.sh", nil)
+			handleHTTPServerRequest(recorder, request)
+			Expect(recorder.Code).To(Equal(http.StatusInternalServerError))
+			Expect(recorder.Body.String()).To(ContainSubstring("couldn't render"))
+		})
+	})
+
+	Describe("Waiting for raw text", func() {
+		It("should return the response once it is resolved", func() {
+			request := rawTextRequests.add(nil)
+			go rawTextRequests.resolve(request.ID, "rendered")
+			response, err := waitForRawText(context.Background(), request, 1)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(response).To(Equal("rendered"))
+		})
+		It("should stop waiting when the context is cancelled", func() {
+			ctx, cancel := context.WithCancel(context.Background())
+			request := rawTextRequests.add(nil)
+			cancel()
+			_, err := waitForRawText(ctx, request, 1)
+			Expect(err).To(MatchError(context.Canceled))
+			Expect(rawTextRequests.resolve(request.ID, "too late")).To(BeFalse())
+		})
+		It("should not resolve unknown requests", func() {
+			Expect(rawTextRequests.resolve("unknown", "rendered")).To(BeFalse())
+		})
+	})
+
+	Describe("Links mode", func() {
+		It("should return the links as JSON", func() {
+			response := rawTextResponse{
+				Text:  "ignored",
+				Title: "Browsh",
+				URL:   "https://www.brow.sh/",
+				Links: []rawTextLink{{
+					Text:     "Docs",
+					Href:     "https://www.brow.sh/docs/",
+					Position: &rawTextLinkPosition{Column: 2, Row: 1, Width: 4, Height: 1},
+				}},
+			}
+			Expect(rawTextBody(response, "LINKS")).To(MatchJSON(`{
+				"title": "Browsh",
+				"url": "https://www.brow.sh/",
+				"links": [{
+					"text": "Docs",
+					"href": "https://www.brow.sh/docs/",
+					"position": {"column": 2, "row": 1, "width": 4, "height": 1}
+				}]
+			}`))
+		})
+		It("should return an empty list for pages without links", func() {
+			Expect(rawTextBody(rawTextResponse{}, "LINKS")).To(ContainSubstring(`"links":[]`))
+		})
+		It("should return the text for other modes", func() {
+			Expect(rawTextBody(rawTextResponse{Text: "hello"}, "PLAIN")).To(Equal("hello"))
+		})
 	})
 })
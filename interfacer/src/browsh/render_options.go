@@ -0,0 +1,114 @@
+package browsh
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+const renderOptionQueryPrefix = "browsh_"
+
+// The render options that a client can override for a single request. Each one can be
+// given either as a header or as a query parameter on the requested URL, eg;
+// `X-Browsh-Columns: 40` or `https://html.brow.sh/https://www.brow.sh?browsh_columns=40`
+var renderOptionNames = map[string]string{
+	"columns":          "X-Browsh-Columns",
+	"rows":             "X-Browsh-Rows",
+	"render_delay":     "X-Browsh-Render-Delay",
+	"timeout":          "X-Browsh-Timeout",
+	"jpeg_compression": "X-Browsh-Jpeg-Compression",
+	"link_footnotes":   "X-Browsh-Link-Footnotes",
+}
+
+// Collect any per-request render options and return the URL for Browsh with the
+// `browsh_` query parameters removed, so they never reach the requested site.
+func getRawTextOptions(r *http.Request, urlForBrowsh string) (string, rawTextOptions, error) {
+	var options rawTextOptions
+	var err error
+	urlForBrowsh, params := extractRenderOptionParams(urlForBrowsh)
+	for name, header := range renderOptionNames {
+		if value := r.Header.Get(header); value != "" {
+			params[name] = value
+		}
+	}
+	for name, value := range params {
+		if err = options.set(name, value); err != nil {
+			return urlForBrowsh, options, err
+		}
+	}
+	return urlForBrowsh, options, options.validate()
+}
+
+// This deliberately avoids parsing and re-encoding the whole query string, as that could
+// subtly change the URL that the user asked for.
+func extractRenderOptionParams(urlForBrowsh string) (string, map[string]string) {
+	params := make(map[string]string)
+	base, query, hasQuery := strings.Cut(urlForBrowsh, "?")
+	if !hasQuery {
+		return urlForBrowsh, params
+	}
+	var kept []string
+	for _, pair := range strings.Split(query, "&") {
+		key, value, _ := strings.Cut(pair, "=")
+		name := strings.TrimPrefix(key, renderOptionQueryPrefix)
+		if _, ok := renderOptionNames[name]; ok && strings.HasPrefix(key, renderOptionQueryPrefix) {
+			params[name] = value
+			continue
+		}
+		kept = append(kept, pair)
+	}
+	if len(kept) == 0 {
+		return base, params
+	}
+	return base + "?" + strings.Join(kept, "&"), params
+}
+
+func (o *rawTextOptions) set(name, value string) error {
+	var err error
+	switch name {
+	case "columns":
+		o.Columns, err = strconv.Atoi(value)
+	case "rows":
+		o.Rows, err = strconv.Atoi(value)
+	case "render_delay":
+		o.RenderDelay, err = strconv.Atoi(value)
+	case "timeout":
+		o.Timeout, err = strconv.Atoi(value)
+	case "jpeg_compression":
+		o.JpegCompression, err = strconv.ParseFloat(value, 64)
+	case "link_footnotes":
+		var isOn bool
+		isOn, err = strconv.ParseBool(value)
+		o.LinkFootnotes = &isOn
+	}
+	if err != nil {
+		return fmt.Errorf("Invalid value for %s: %s", name, value)
+	}
+	return nil
+}
+
+// Make sure that clients can't ask for more resources than the server allows
+func (o rawTextOptions) validate() error {
+	limits := []struct {
+		name  string
+		value int
+		max   int
+	}{
+		{"columns", o.Columns, viper.GetInt("http-server.max-columns")},
+		{"rows", o.Rows, viper.GetInt("http-server.max-rows")},
+		{"render_delay", o.RenderDelay, viper.GetInt("http-server.max-render-delay")},
+		{"timeout", o.Timeout, viper.GetInt("http-server.max-timeout")},
+	}
+	for _, limit := range limits {
+		if limit.value < 0 || limit.value > limit.max {
+			return fmt.Errorf("%s must be between 0 and %d", limit.name, limit.max)
+		}
+	}
+	if o.JpegCompression < 0 || o.JpegCompression > 1 {
+		return fmt.Errorf("jpeg_compression must be between 0 and 1")
+	}
+	return nil
+}
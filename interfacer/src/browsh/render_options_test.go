@@ -0,0 +1,76 @@
+package browsh
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/spf13/viper"
+)
+
+func TestRenderOptions(t *testing.T) {
+	RegisterFailHandler(Fail)
+}
+
+var _ = Describe("Render options", func() {
+	BeforeEach(func() {
+		viper.Set("http-server.max-columns", 400)
+		viper.Set("http-server.max-rows", 200)
+		viper.Set("http-server.max-render-delay", 5000)
+		viper.Set("http-server.max-timeout", 60)
+	})
+
+	It("should read options from headers", func() {
+		request := httptest.NewRequest("GET", "/", nil)
+		request.Header.Set("X-Browsh-Columns", "40")
+		request.Header.Set("X-Browsh-Jpeg-Compression", "0.5")
+		_, options, err := getRawTextOptions(request, "https://www.brow.sh")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(options.Columns).To(Equal(40))
+		Expect(options.JpegCompression).To(Equal(0.5))
+	})
+
+	It("should read and remove options from the query string", func() {
+		request := httptest.NewRequest("GET", "/", nil)
+		urlForBrowsh, options, err := getRawTextOptions(
+			request, "https://example.com/?q=a%20b&browsh_rows=50&page=2")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(options.Rows).To(Equal(50))
+		Expect(urlForBrowsh).To(Equal("https://example.com/?q=a%20b&page=2"))
+	})
+
+	It("should remove an emptied query string", func() {
+		urlForBrowsh, _ := extractRenderOptionParams("https://example.com/?browsh_timeout=5")
+		Expect(urlForBrowsh).To(Equal("https://example.com/"))
+	})
+
+	It("should leave unrelated query parameters alone", func() {
+		urlForBrowsh, params := extractRenderOptionParams("https://example.com/?browsh_x=1")
+		Expect(urlForBrowsh).To(Equal("https://example.com/?browsh_x=1"))
+		Expect(params).To(BeEmpty())
+	})
+
+	It("should reject values above the configured maxima", func() {
+		request := httptest.NewRequest("GET", "/", nil)
+		request.Header.Set("X-Browsh-Columns", "1000")
+		_, _, err := getRawTextOptions(request, "https://www.brow.sh")
+		Expect(err).To(MatchError("columns must be between 0 and 400"))
+	})
+
+	It("should read link footnotes as a boolean", func() {
+		request := httptest.NewRequest("GET", "/", nil)
+		_, options, err := getRawTextOptions(
+			request, "https://example.com/?browsh_link_footnotes=false")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(options.LinkFootnotes).ToNot(BeNil())
+		Expect(*options.LinkFootnotes).To(BeFalse())
+	})
+
+	It("should reject values that aren't numbers", func() {
+		request := httptest.NewRequest("GET", "/", nil)
+		request.Header.Set("X-Browsh-Timeout", "soon")
+		_, _, err := getRawTextOptions(request, "https://www.brow.sh")
+		Expect(err).To(HaveOccurred())
+	})
+})
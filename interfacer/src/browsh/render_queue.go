@@ -0,0 +1,160 @@
+package browsh
+
+import (
+	"container/list"
+	"context"
+	"log/slog"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/go-errors/errors"
+	"github.com/spf13/viper"
+)
+
+// Limits how many pages Firefox renders at once, nil when there's no limit
+var renderQueue *renderJobQueue
+
+var (
+	errRenderQueueFull    = errors.New("Too many pages are waiting to be rendered")
+	errRenderQueueTimeout = errors.New("Timed out waiting for a free renderer")
+)
+
+// Renders beyond `max-concurrency` wait in a FIFO queue for a render to finish. The
+// queue is bounded so that under heavy load requests fail quickly, rather than all of
+// them slowly timing out.
+type renderJobQueue struct {
+	sync.Mutex
+	maxActive int
+	maxQueued int
+	timeout   time.Duration
+	active    int
+	waiting   *list.List
+}
+
+// A queued render. Its turn has come once `ready` is closed.
+type renderJob struct {
+	ready   chan struct{}
+	started bool
+}
+
+func setupRenderQueue() {
+	maxActive := viper.GetInt("http-server.max-concurrency")
+	if maxActive <= 0 {
+		renderQueue = nil
+		return
+	}
+	renderQueue = newRenderJobQueue(
+		maxActive,
+		viper.GetInt("http-server.queue-size"),
+		time.Duration(viper.GetInt("http-server.queue-timeout"))*time.Second,
+	)
+}
+
+func newRenderJobQueue(maxActive, maxQueued int, timeout time.Duration) *renderJobQueue {
+	return &renderJobQueue{
+		maxActive: maxActive,
+		maxQueued: maxQueued,
+		timeout:   timeout,
+		waiting:   list.New(),
+	}
+}
+
+// Wait for a turn to render. Every successful call must be followed by a call to
+// `done()` once the render has finished.
+func (q *renderJobQueue) start(ctx context.Context) error {
+	if q == nil {
+		return nil
+	}
+	q.Lock()
+	if q.active < q.maxActive {
+		q.active++
+		q.Unlock()
+		return nil
+	}
+	if q.waiting.Len() >= q.maxQueued {
+		q.Unlock()
+		slog.Info("Render queue is full", "active", q.maxActive, "queued", q.maxQueued)
+		return errRenderQueueFull
+	}
+	job := &renderJob{ready: make(chan struct{})}
+	element := q.waiting.PushBack(job)
+	slog.Info("Queued render", "active", q.active, "queued", q.waiting.Len())
+	q.Unlock()
+
+	timer := time.NewTimer(q.timeout)
+	defer timer.Stop()
+	var err error
+	select {
+	case <-job.ready:
+		return nil
+	case <-timer.C:
+		err = errRenderQueueTimeout
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+	q.Lock()
+	defer q.Unlock()
+	if job.started {
+		// Our turn came just as we gave up, so pass it on to the next job
+		q.next()
+		return err
+	}
+	q.waiting.Remove(element)
+	return err
+}
+
+func (q *renderJobQueue) done() {
+	if q == nil {
+		return
+	}
+	q.Lock()
+	defer q.Unlock()
+	q.next()
+}
+
+// Hand a finished render's slot straight to the job at the front of the queue, so that
+// new renders can't jump ahead of it.
+func (q *renderJobQueue) next() {
+	front := q.waiting.Front()
+	if front == nil {
+		q.active--
+		return
+	}
+	job := q.waiting.Remove(front).(*renderJob)
+	job.started = true
+	close(job.ready)
+}
+
+// The number of renders that are in progress and that are waiting for their turn
+func (q *renderJobQueue) depth() (int, int) {
+	if q == nil {
+		return 0, 0
+	}
+	q.Lock()
+	defer q.Unlock()
+	return q.active, q.waiting.Len()
+}
+
+// Whether new renders would be turned away
+func (q *renderJobQueue) isFull() bool {
+	if q == nil {
+		return false
+	}
+	q.Lock()
+	defer q.Unlock()
+	return q.active >= q.maxActive && q.waiting.Len() >= q.maxQueued
+}
+
+// How long clients should wait before trying again when the queue is full
+func (q *renderJobQueue) retryAfter() string {
+	seconds := int(q.timeout / time.Second)
+	if seconds < 1 {
+		seconds = 1
+	}
+	return strconv.Itoa(seconds)
+}
+
+func isRenderQueueError(err error) bool {
+	return errors.Is(err, errRenderQueueFull) || errors.Is(err, errRenderQueueTimeout)
+}
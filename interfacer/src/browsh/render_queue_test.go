@@ -0,0 +1,77 @@
+package browsh
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+func TestRenderQueue(t *testing.T) {
+	RegisterFailHandler(Fail)
+}
+
+var _ = Describe("Render queue", func() {
+	var queue *renderJobQueue
+
+	BeforeEach(func() {
+		queue = newRenderJobQueue(1, 2, time.Second)
+	})
+
+	It("should start renders straight away while under the limit", func() {
+		Expect(queue.start(context.Background())).To(Succeed())
+		active, queued := queue.depth()
+		Expect(active).To(Equal(1))
+		Expect(queued).To(Equal(0))
+	})
+
+	It("should start queued renders in the order they arrived", func() {
+		Expect(queue.start(context.Background())).To(Succeed())
+		order := make(chan int, 2)
+		for i := 1; i <= 2; i++ {
+			go func(i int) {
+				defer GinkgoRecover()
+				Expect(queue.start(context.Background())).To(Succeed())
+				order <- i
+				queue.done()
+			}(i)
+			Eventually(func() int { _, queued := queue.depth(); return queued }).Should(Equal(i))
+		}
+		queue.done()
+		Expect(<-order).To(Equal(1))
+		Expect(<-order).To(Equal(2))
+		Eventually(func() int { active, _ := queue.depth(); return active }).Should(Equal(0))
+	})
+
+	It("should turn away renders when the queue is full", func() {
+		queue = newRenderJobQueue(1, 0, time.Second)
+		Expect(queue.start(context.Background())).To(Succeed())
+		Expect(queue.start(context.Background())).To(MatchError(errRenderQueueFull))
+	})
+
+	It("should give up on renders that wait too long", func() {
+		queue = newRenderJobQueue(1, 1, 10*time.Millisecond)
+		Expect(queue.start(context.Background())).To(Succeed())
+		Expect(queue.start(context.Background())).To(MatchError(errRenderQueueTimeout))
+		_, queued := queue.depth()
+		Expect(queued).To(Equal(0))
+	})
+
+	It("should stop waiting when the client goes away", func() {
+		Expect(queue.start(context.Background())).To(Succeed())
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		Expect(queue.start(ctx)).To(MatchError(context.Canceled))
+		queue.done()
+		active, _ := queue.depth()
+		Expect(active).To(Equal(0))
+	})
+
+	It("should not limit anything when there's no queue", func() {
+		var unlimited *renderJobQueue
+		Expect(unlimited.start(context.Background())).To(Succeed())
+		unlimited.done()
+	})
+})
@@ -0,0 +1,55 @@
+package browsh
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/go-errors/errors"
+	"github.com/spf13/viper"
+)
+
+// Whether `serveUntilSignalled()` will handle signals, rather than the usual
+// `quitOnSignals()`. Dump mode also runs as if it were the HTTP server, but doesn't
+// serve anything, so it still quits on signals as usual.
+var isServerHandlingSignals = false
+
+// Serve HTTP requests until Browsh is asked to quit. Rather than dropping whatever is
+// in flight, the server stops accepting new requests and waits for its current ones to
+// finish before quitting Firefox. A second signal quits straight away.
+func serveUntilSignalled(server *http.Server) {
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
+	drained := make(chan struct{})
+	go func() {
+		<-sigs
+		go func() {
+			<-sigs
+			slog.Info("Quitting without waiting for requests to finish")
+			quitBrowsh()
+		}()
+		grace := time.Duration(viper.GetInt("http-server.shutdown-grace-period")) * time.Second
+		slog.Info("Waiting for requests to finish before quitting", "grace", grace)
+		if err := drainHTTPServer(server, grace); err != nil {
+			slog.Info("Requests were still in flight after the grace period", "error", err)
+		}
+		close(drained)
+	}()
+	if err := listenAndServe(server); !errors.Is(err, http.ErrServerClosed) {
+		Shutdown(err)
+	}
+	<-drained
+	quitBrowsh()
+}
+
+// Stop accepting new requests and give the ones in flight, including renders waiting
+// in the render queue, up to the grace period to finish
+func drainHTTPServer(server *http.Server, grace time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), grace)
+	defer cancel()
+	return server.Shutdown(ctx)
+}
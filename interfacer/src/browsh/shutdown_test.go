@@ -0,0 +1,75 @@
+package browsh
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+func TestShutdown(t *testing.T) {
+	RegisterFailHandler(Fail)
+}
+
+var _ = Describe("Graceful shutdown", func() {
+	var server *http.Server
+	var address string
+	var rendering, finishRender chan struct{}
+
+	get := func() (string, error) {
+		response, err := http.Get("http://" + address + "/")
+		if err != nil {
+			return "", err
+		}
+		defer response.Body.Close()
+		body, err := io.ReadAll(response.Body)
+		return string(body), err
+	}
+
+	BeforeEach(func() {
+		rendering = make(chan struct{}, 1)
+		finishRender = make(chan struct{})
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		Expect(err).ToNot(HaveOccurred())
+		address = listener.Addr().String()
+		server = &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			rendering <- struct{}{}
+			<-finishRender
+			io.WriteString(w, "rendered")
+		})}
+		go server.Serve(listener)
+	})
+
+	It("should let requests in flight finish", func() {
+		body := make(chan string, 1)
+		go func() {
+			text, _ := get()
+			body <- text
+		}()
+		Eventually(rendering).Should(Receive())
+		drained := make(chan error, 1)
+		go func() { drained <- drainHTTPServer(server, 5*time.Second) }()
+		Consistently(drained, 100*time.Millisecond).ShouldNot(Receive())
+		close(finishRender)
+		Eventually(body).Should(Receive(Equal("rendered")))
+		Eventually(drained).Should(Receive(BeNil()))
+	})
+
+	It("should stop accepting new requests", func() {
+		close(finishRender)
+		Expect(drainHTTPServer(server, time.Second)).To(Succeed())
+		_, err := get()
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("should give up on requests that outlast the grace period", func() {
+		go get()
+		Eventually(rendering).Should(Receive())
+		Expect(drainHTTPServer(server, 50*time.Millisecond)).ToNot(Succeed())
+		close(finishRender)
+	})
+})
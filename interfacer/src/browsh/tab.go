@@ -2,7 +2,6 @@ package browsh
 
 import (
 	"encoding/json"
-	"fmt"
 )
 
 // Tabs is a map of all tab data
@@ -66,7 +65,7 @@ func removeTab(id int) {
 		quitBrowsh()
 	}
 	tabsDeleted = append(tabsDeleted, id)
-	sendMessageToWebExtension(fmt.Sprintf("/remove_tab,%d", id))
+	sendMessageToWebExtension(newTabMessage("/remove_tab", id, nil))
 	nextTab()
 	removeTabIDfromTabsOrder(id)
 	delete(Tabs, id)
@@ -116,7 +115,7 @@ func nextTab() {
 			} else {
 				i++
 			}
-			sendMessageToWebExtension(fmt.Sprintf("/switch_to_tab,%d", tabsOrder[i]))
+			sendMessageToWebExtension(newTabMessage("/switch_to_tab", tabsOrder[i], nil))
 			CurrentTab = Tabs[tabsOrder[i]]
 			renderUI()
 			renderCurrentTabWindow()
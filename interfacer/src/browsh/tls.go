@@ -0,0 +1,126 @@
+package browsh
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"log/slog"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/go-errors/errors"
+	"github.com/spf13/viper"
+)
+
+func isTLSEnabled() bool {
+	return viper.GetString("http-server.tls-cert") != "" ||
+		viper.GetString("http-server.tls-key") != "" ||
+		viper.GetBool("http-server.tls-self-signed")
+}
+
+// Serve HTTPS when there's a certificate, otherwise plain HTTP
+func listenAndServe(server *http.Server) error {
+	if !isTLSEnabled() {
+		return server.ListenAndServe()
+	}
+	certificate, err := getTLSCertificate()
+	if err != nil {
+		return err
+	}
+	server.TLSConfig = &tls.Config{
+		Certificates: []tls.Certificate{certificate},
+		MinVersion:   tls.VersionTLS12,
+	}
+	if port := viper.GetString("http-server.http-redirect-port"); port != "" && port != "0" {
+		go serveHTTPSRedirects(viper.GetString("http-server.bind") + ":" + port)
+	}
+	return server.ListenAndServeTLS("", "")
+}
+
+func getTLSCertificate() (tls.Certificate, error) {
+	certFile := viper.GetString("http-server.tls-cert")
+	keyFile := viper.GetString("http-server.tls-key")
+	if certFile == "" && keyFile == "" {
+		slog.Info("Serving HTTPS with a self-signed certificate")
+		return newSelfSignedCertificate()
+	}
+	if certFile == "" || keyFile == "" {
+		return tls.Certificate{}, errors.New(
+			"Both http-server.tls-cert and http-server.tls-key are needed to serve HTTPS")
+	}
+	return tls.LoadX509KeyPair(certFile, keyFile)
+}
+
+// Only for trying out HTTPS locally, clients will need to skip verifying it, like with
+// `curl --insecure`. The certificate is made afresh whenever Browsh starts.
+func newSelfSignedCertificate() (tls.Certificate, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{Organization: []string{"Browsh"}, CommonName: "localhost"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().AddDate(1, 0, 0),
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		DNSNames:              []string{"localhost"},
+		IPAddresses:           []net.IP{net.IPv4(127, 0, 0, 1), net.IPv6loopback},
+	}
+	if hostname, err := os.Hostname(); err == nil && hostname != "localhost" {
+		template.DNSNames = append(template.DNSNames, hostname)
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}, nil
+}
+
+// A plain HTTP server that only sends clients to the HTTPS one
+func serveHTTPSRedirects(address string) {
+	slog.Info("Redirecting plain HTTP to HTTPS", "address", address)
+	redirect := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, getHTTPSURL(r), http.StatusMovedPermanently)
+	})
+	if err := http.ListenAndServe(address, redirect); err != nil {
+		Shutdown(err)
+	}
+}
+
+// Requests that reached a proxy or load balancer in front of Browsh over plain HTTP.
+// brow.sh's own deployment always redirects them.
+func shouldRedirectToHTTPS(r *http.Request) bool {
+	if !viper.GetBool("http-server.https-redirect") && !strings.Contains(r.Host, "brow.sh") {
+		return false
+	}
+	return r.Header.Get("X-Forwarded-Proto") == "http"
+}
+
+// The same URL, but over HTTPS. When Browsh is serving HTTPS itself, then the port
+// needs to be its HTTPS port, rather than the port of the plain HTTP request.
+func getHTTPSURL(r *http.Request) string {
+	host := r.Host
+	if isTLSEnabled() && r.Header.Get("X-Forwarded-Proto") == "" {
+		hostname, _, err := net.SplitHostPort(r.Host)
+		if err != nil {
+			hostname = strings.Trim(r.Host, "[]")
+		}
+		port := viper.GetString("http-server.port")
+		host = strings.TrimSuffix(net.JoinHostPort(hostname, port), ":443")
+	}
+	return "https://" + host + r.RequestURI
+}
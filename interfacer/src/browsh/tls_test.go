@@ -0,0 +1,68 @@
+package browsh
+
+import (
+	"crypto/x509"
+	"net/http/httptest"
+	"testing"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/spf13/viper"
+)
+
+func TestTLS(t *testing.T) {
+	RegisterFailHandler(Fail)
+}
+
+var _ = Describe("TLS", func() {
+	AfterEach(func() {
+		viper.Set("http-server.tls-self-signed", false)
+		viper.Set("http-server.https-redirect", false)
+		viper.Set("http-server.port", nil)
+	})
+
+	It("should make a self-signed certificate for local use", func() {
+		certificate, err := newSelfSignedCertificate()
+		Expect(err).ToNot(HaveOccurred())
+		parsed, err := x509.ParseCertificate(certificate.Certificate[0])
+		Expect(err).ToNot(HaveOccurred())
+		Expect(parsed.VerifyHostname("localhost")).To(Succeed())
+		Expect(parsed.VerifyHostname("127.0.0.1")).To(Succeed())
+	})
+
+	Describe("redirecting to HTTPS", func() {
+		It("should only redirect proxied plain HTTP when asked to", func() {
+			r := httptest.NewRequest("GET", "http://example.com/https://www.brow.sh", nil)
+			r.Header.Set("X-Forwarded-Proto", "http")
+			Expect(shouldRedirectToHTTPS(r)).To(BeFalse())
+			viper.Set("http-server.https-redirect", true)
+			Expect(shouldRedirectToHTTPS(r)).To(BeTrue())
+			r.Header.Set("X-Forwarded-Proto", "https")
+			Expect(shouldRedirectToHTTPS(r)).To(BeFalse())
+		})
+
+		It("should always redirect brow.sh's proxied plain HTTP", func() {
+			r := httptest.NewRequest("GET", "http://html.brow.sh/https://www.brow.sh", nil)
+			r.Header.Set("X-Forwarded-Proto", "http")
+			Expect(shouldRedirectToHTTPS(r)).To(BeTrue())
+		})
+
+		It("should keep the host of proxied requests", func() {
+			r := httptest.NewRequest("GET", "/https://www.brow.sh?a=1", nil)
+			r.Header.Set("X-Forwarded-Proto", "http")
+			Expect(getHTTPSURL(r)).To(Equal("https://example.com/https://www.brow.sh?a=1"))
+		})
+
+		It("should use Browsh's own HTTPS port when it serves HTTPS", func() {
+			viper.Set("http-server.tls-self-signed", true)
+			viper.Set("http-server.port", "4333")
+			r := httptest.NewRequest("GET", "/https://www.brow.sh", nil)
+			r.Host = "[::1]:8080"
+			Expect(getHTTPSURL(r)).To(Equal("https://[::1]:4333/https://www.brow.sh"))
+			viper.Set("http-server.port", "443")
+			r = httptest.NewRequest("GET", "/", nil)
+			r.Host = "example.com:8080"
+			Expect(getHTTPSURL(r)).To(Equal("https://example.com/"))
+		})
+	})
+})
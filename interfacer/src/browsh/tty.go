@@ -1,7 +1,6 @@
 package browsh
 
 import (
-	"encoding/json"
 	"fmt"
 	"os"
 	"strconv"
@@ -29,12 +28,13 @@ func setupTcell() {
 	IsMonochromeMode = viper.GetBool("monochrome")
 	screen.EnableMouse()
 	screen.Clear()
+	invalidateTabWindow()
 }
 
 func sendTtySize() {
 	width, height := screen.Size()
 	urlInputBox.Width = width
-	sendMessageToWebExtension(fmt.Sprintf("/tty_size,%d,%d", width, height))
+	sendCommandToWebExtension("/tty_size", ttySizePayload{Width: width, Height: height})
 }
 
 // This is basically a proxy that listens to STDIN and forwards all relevant input
@@ -69,13 +69,14 @@ func handleUserKeyPress(ev *tcell.EventKey) {
 		createNewEmptyTab()
 	case tcell.KeyCtrlU:
 		if !isNewEmptyTabActive() {
-			sendMessageToWebExtension("/new_tab,view-source:" + CurrentTab.URI)
+			sendCommandToWebExtension("/new_tab",
+				newTabPayload{URL: "view-source:" + CurrentTab.URI})
 		}
 	case tcell.KeyCtrlW:
 		removeTab(CurrentTab.ID)
 	case tcell.KeyBackspace, tcell.KeyBackspace2:
 		if activeInputBox == nil {
-			sendMessageToWebExtension("/tab_command,/history_back")
+			sendTabCommand("/history_back", nil)
 		}
 	}
 	if ev.Rune() == 'm' && ev.Modifiers() == 4 {
@@ -117,23 +118,23 @@ func quitBrowsh() {
 
 func toggleMonochromeMode() {
 	IsMonochromeMode = !IsMonochromeMode
+	invalidateTabWindow()
 }
 
 func openHelpTab() {
-	sendMessageToWebExtension("/new_tab,https://www.brow.sh/docs/introduction/")
+	sendCommandToWebExtension("/new_tab",
+		newTabPayload{URL: "https://www.brow.sh/docs/introduction/"})
 }
 
 func forwardKeyPress(ev *tcell.EventKey) {
 	if isMultiLineEnter(ev) {
 		return
 	}
-	eventMap := map[string]interface{}{
-		"key":  int(ev.Key()),
-		"char": string(ev.Rune()),
-		"mod":  int(ev.Modifiers()),
-	}
-	marshalled, _ := json.Marshal(eventMap)
-	sendMessageToWebExtension("/stdin," + string(marshalled))
+	sendCommandToWebExtension("/stdin", keyPressPayload{
+		Key:  int(ev.Key()),
+		Char: string(ev.Rune()),
+		Mod:  int(ev.Modifiers()),
+	})
 }
 
 // Allow user to use ENTER key without triggering submission on multiline input
@@ -162,11 +163,7 @@ func handleScrolling(ev *tcell.EventKey) {
 		CurrentTab.frame.yScroll += height
 	}
 	CurrentTab.frame.limitScroll(height)
-	sendMessageToWebExtension(
-		fmt.Sprintf(
-			"/tab_command,/scroll_status,%d,%d",
-			CurrentTab.frame.xScroll,
-			CurrentTab.frame.yScroll*2))
+	sendScrollStatus()
 	if CurrentTab.frame.yScroll != yScrollOriginal {
 		renderCurrentTabWindow()
 	}
@@ -186,14 +183,12 @@ func handleMouseEvent(ev *tcell.EventMouse) {
 	if button == 1 {
 		CurrentTab.frame.maybeFocusInputBox(xInFrame, yInFrame)
 	}
-	eventMap := map[string]interface{}{
-		"button":    int(button),
-		"mouse_x":   int(xInFrame),
-		"mouse_y":   int(yInFrame),
-		"modifiers": int(ev.Modifiers()),
-	}
-	marshalled, _ := json.Marshal(eventMap)
-	sendMessageToWebExtension("/stdin," + string(marshalled))
+	sendCommandToWebExtension("/stdin", mouseEventPayload{
+		Button:    int(button),
+		MouseX:    xInFrame,
+		MouseY:    yInFrame,
+		Modifiers: int(ev.Modifiers()),
+	})
 }
 
 func handleMouseScroll(scrollType tcell.ButtonMask) {
@@ -206,11 +201,7 @@ func handleMouseScroll(scrollType tcell.ButtonMask) {
 		CurrentTab.frame.yScroll += 1
 	}
 	CurrentTab.frame.limitScroll(height)
-	sendMessageToWebExtension(
-		fmt.Sprintf(
-			"/tab_command,/scroll_status,%d,%d",
-			CurrentTab.frame.xScroll,
-			CurrentTab.frame.yScroll*2))
+	sendScrollStatus()
 	if CurrentTab.frame.yScroll != yScrollOriginal {
 		renderCurrentTabWindow()
 	}
@@ -220,24 +211,41 @@ func handleTTYResize() {
 	width, _ := screen.Size()
 	urlInputBox.Width = width
 	screen.Sync()
+	invalidateTabWindow()
 	sendTtySize()
 }
 
 // Tcell uses a buffer to collect screen updates on, it only actually sends
 // ANSI rendering commands to the terminal when we tell it to. And even then it
 // will try to minimise rendering commands by only rendering parts of the terminal
-// that have changed.
+// that have changed. Browsh itself only draws the parts of the frame that have
+// changed since the last render, or that scrolling brought into view, see
+// `regionsToRender()`.
 func renderCurrentTabWindow() {
-	var currentCell cell
-	styling := tcell.StyleDefault
-	var runeChars []rune
 	width, height := screen.Size()
 	if CurrentTab == nil || CurrentTab.frame.cells == nil {
 		return
 	}
 	CurrentTab.frame.overlayInputBoxContent()
-	for y := 0; y < height-uiHeight; y++ {
-		for x := 0; x < width; x++ {
+	regions, scrolled := regionsToRender(CurrentTab, width, height-uiHeight)
+	shiftTabWindow(scrolled, width, height-uiHeight)
+	for _, region := range regions {
+		renderRegion(region)
+	}
+	if activeInputBox != nil {
+		activeInputBox.renderCursor()
+	}
+	overlayPageStatusMessage()
+	overlayCallToSupport()
+	screen.Show()
+}
+
+func renderRegion(region cellRegion) {
+	var currentCell cell
+	styling := tcell.StyleDefault
+	var runeChars []rune
+	for y := region.top; y < region.bottom; y++ {
+		for x := region.left; x < region.right; x++ {
 			currentCell = getCell(x, y)
 			runeChars = currentCell.character
 			// TODO: do this is in isCharacterTransparent()
@@ -257,12 +265,6 @@ func renderCurrentTabWindow() {
 			screen.SetCell(x, y+uiHeight, styling, runeChars[0])
 		}
 	}
-	if activeInputBox != nil {
-		activeInputBox.renderCursor()
-	}
-	overlayPageStatusMessage()
-	overlayCallToSupport()
-	screen.Show()
 }
 
 func getCell(x, y int) cell {
@@ -292,3 +294,11 @@ func getHatchedCellColours(x int) (tcell.Color, tcell.Color) {
 	}
 	return fgColour, bgColour
 }
+
+// The content script scrolls the page to match the TTY's scroll position
+func sendScrollStatus() {
+	sendTabCommand("/scroll_status", scrollStatusPayload{
+		X: CurrentTab.frame.xScroll,
+		Y: CurrentTab.frame.yScroll * 2,
+	})
+}
@@ -113,6 +113,19 @@ func overlayPageStatusMessage() {
 	writeString(0, height-1, CurrentTab.StatusMessage, tcell.StyleDefault)
 }
 
+// For when Browsh itself, rather than the page, has something to say, like that it's
+// lost its connection to Firefox. It stays until the next frame is rendered.
+func showConnectionStatus(message string) {
+	if viper.GetBool("http-server-mode") || screen == nil {
+		slog.Info(message)
+		return
+	}
+	_, height := screen.Size()
+	writeString(0, height-1, message, tcell.StyleDefault)
+	fillLineToEnd(len(message), height-1)
+	screen.Show()
+}
+
 func overlayCallToSupport() {
 	var right int
 	var message string
@@ -0,0 +1,133 @@
+package browsh
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+// The webextension's ID on addons.mozilla.org, as in `webext/manifest.json`
+const webextensionID = "{8ff2d753-2dc8-46de-a837-fa28331d9fcf}"
+
+// Whatever connects to the websocket can control Firefox and read everything that's typed
+// into Browsh, so only a webextension that knows this token can connect. It's made afresh
+// every time Browsh starts.
+var websocketToken = newWebsocketToken()
+
+// Where the token was shared, so that it can be removed when Browsh exits
+var sharedWebsocketTokenPath string
+
+// Firefox's "managed storage" for a webextension. It's how Browsh gets the token, and
+// the websocket's address, to the webextension before the webextension has connected
+// to anything.
+type managedStorageManifest struct {
+	Name        string            `json:"name"`
+	Description string            `json:"description"`
+	Type        string            `json:"type"`
+	Data        map[string]string `json:"data"`
+}
+
+func newWebsocketToken() string {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
+
+// Write the token where Firefox looks for the webextension's managed storage. Only the
+// current user can read it. Firefox only looks for managed storage in the one place for
+// each user, rather than in each profile, so every Browsh that the user runs writes to
+// the same file. It's removed again when Browsh exits, see `unshareWebsocketToken()`.
+func shareWebsocketToken() {
+	path, err := getManagedStoragePath()
+	if err != nil {
+		Shutdown(err)
+	}
+	if err := writeManagedStorageManifest(path, websocketToken, getWebsocketURL()); err != nil {
+		Shutdown(err)
+	}
+	sharedWebsocketTokenPath = path
+}
+
+// So that the token doesn't outlive Browsh
+func unshareWebsocketToken() {
+	if sharedWebsocketTokenPath == "" {
+		return
+	}
+	if err := removeManagedStorageManifest(sharedWebsocketTokenPath, websocketToken); err != nil {
+		slog.Error("Couldn't remove the websocket token", "path", sharedWebsocketTokenPath, "error", err)
+	}
+	sharedWebsocketTokenPath = ""
+}
+
+// Where the webextension connects to. Firefox runs on the same machine as Browsh, so
+// when the websocket listens on every address, the webextension connects over loopback.
+func getWebsocketURL() string {
+	host := viper.GetString("browsh.websocket-bind")
+	if ip := net.ParseIP(host); host == "" || (ip != nil && ip.IsUnspecified()) {
+		host = "127.0.0.1"
+	}
+	return "ws://" + net.JoinHostPort(host, viper.GetString("browsh.websocket-port")) + "/"
+}
+
+func writeManagedStorageManifest(path, token, url string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+	manifest, _ := json.MarshalIndent(managedStorageManifest{
+		Name:        webextensionID,
+		Description: "How Browsh's webextension connects to Browsh",
+		Type:        "storage",
+		Data: map[string]string{
+			"websocket_token": token,
+			"websocket_url":   url,
+		},
+	}, "", "  ")
+	if err := os.WriteFile(path, manifest, 0o600); err != nil {
+		return err
+	}
+	// `WriteFile` doesn't change the permissions of a file that already exists
+	return os.Chmod(path, 0o600)
+}
+
+// Another Browsh may have since started and shared its own token, which its Firefox
+// still needs
+func removeManagedStorageManifest(path, token string) error {
+	contents, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var manifest managedStorageManifest
+	if err := json.Unmarshal(contents, &manifest); err != nil {
+		return err
+	}
+	if manifest.Data["websocket_token"] != token {
+		return nil
+	}
+	return os.Remove(path)
+}
+
+func isWebsocketTokenValid(r *http.Request) bool {
+	token := r.URL.Query().Get("token")
+	return subtle.ConstantTimeCompare([]byte(token), []byte(websocketToken)) == 1
+}
+
+// Web pages can open websockets too, but only the webextension's background page has
+// a `moz-extension://` origin
+func isWebextensionOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	return origin == "" || strings.HasPrefix(origin, "moz-extension://")
+}
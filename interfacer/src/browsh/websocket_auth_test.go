@@ -0,0 +1,87 @@
+package browsh
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/spf13/viper"
+)
+
+func TestWebsocketAuth(t *testing.T) {
+	RegisterFailHandler(Fail)
+}
+
+var _ = Describe("Websocket authentication", func() {
+	It("should only accept connections with the token", func() {
+		r := httptest.NewRequest("GET", "/?token="+websocketToken, nil)
+		Expect(isWebsocketTokenValid(r)).To(BeTrue())
+		r = httptest.NewRequest("GET", "/?token=guess", nil)
+		Expect(isWebsocketTokenValid(r)).To(BeFalse())
+		r = httptest.NewRequest("GET", "/", nil)
+		Expect(isWebsocketTokenValid(r)).To(BeFalse())
+	})
+
+	It("should make a different token every time Browsh starts", func() {
+		Expect(newWebsocketToken()).To(HaveLen(64))
+		Expect(newWebsocketToken()).ToNot(Equal(newWebsocketToken()))
+	})
+
+	It("should not accept connections from web pages", func() {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.Header.Set("Origin", "moz-extension://2f1c5a7e-0000-4000-8000-000000000000")
+		Expect(isWebextensionOrigin(r)).To(BeTrue())
+		r.Header.Set("Origin", "https://example.com")
+		Expect(isWebextensionOrigin(r)).To(BeFalse())
+	})
+
+	It("should share the token only with the current user", func() {
+		dir, _ := os.MkdirTemp("", "browsh-managed-storage")
+		defer os.RemoveAll(dir)
+		path := filepath.Join(dir, "managed-storage", webextensionID+".json")
+		Expect(writeManagedStorageManifest(path, "secret", "ws://127.0.0.1:3334/")).To(Succeed())
+		info, _ := os.Stat(path)
+		Expect(info.Mode().Perm()).To(Equal(os.FileMode(0o600)))
+		var manifest managedStorageManifest
+		contents, _ := os.ReadFile(path)
+		Expect(json.Unmarshal(contents, &manifest)).To(Succeed())
+		Expect(manifest.Name).To(Equal(webextensionID))
+		Expect(manifest.Type).To(Equal("storage"))
+		Expect(manifest.Data["websocket_token"]).To(Equal("secret"))
+		Expect(manifest.Data["websocket_url"]).To(Equal("ws://127.0.0.1:3334/"))
+	})
+
+	It("should only remove the token while it's still Browsh's own", func() {
+		dir, _ := os.MkdirTemp("", "browsh-managed-storage")
+		defer os.RemoveAll(dir)
+		path := filepath.Join(dir, webextensionID+".json")
+		Expect(writeManagedStorageManifest(path, "another-browsh", "ws://127.0.0.1:3335/")).To(Succeed())
+		Expect(removeManagedStorageManifest(path, "secret")).To(Succeed())
+		Expect(path).To(BeAnExistingFile())
+		Expect(writeManagedStorageManifest(path, "secret", "ws://127.0.0.1:3334/")).To(Succeed())
+		Expect(removeManagedStorageManifest(path, "secret")).To(Succeed())
+		Expect(path).ToNot(BeAnExistingFile())
+		Expect(removeManagedStorageManifest(path, "secret")).To(Succeed())
+	})
+
+	Describe("The websocket's address", func() {
+		AfterEach(func() {
+			viper.Set("browsh.websocket-bind", "127.0.0.1")
+			viper.Set("browsh.websocket-port", 3334)
+		})
+
+		It("should be the configured address", func() {
+			viper.Set("browsh.websocket-bind", "::1")
+			viper.Set("browsh.websocket-port", 4000)
+			Expect(getWebsocketURL()).To(Equal("ws://[::1]:4000/"))
+		})
+		It("should be loopback when the websocket listens on every address", func() {
+			viper.Set("browsh.websocket-bind", "0.0.0.0")
+			Expect(getWebsocketURL()).To(Equal("ws://127.0.0.1:3334/"))
+		})
+	})
+})
@@ -34,6 +34,20 @@ var _ = Describe("HTTP Server", func() {
 			"<div class=\"big_middle\">"))
 	})
 
+	It("should return Markdown", func() {
+		response := getPath("/smorgasbord", "markdown")
+		Expect(response).To(ContainSubstring("# Smörgåsbord"))
+		Expect(response).To(ContainSubstring(
+			"[Another page](http://localhost:4444/smorgasbord/another.html)"))
+	})
+
+	It("should return the page's links as JSON", func() {
+		response := getPath("/smorgasbord", "links")
+		Expect(response).To(ContainSubstring(
+			`"href":"http://localhost:4444/smorgasbord/another.html"`))
+		Expect(response).To(ContainSubstring(`"position":{"column":`))
+	})
+
 	It("should return a background image", func() {
 		response := getPath("/smorgasbord", "html")
 		Expect(response).To(ContainSubstring("background-image: url(data:image/jpeg"))
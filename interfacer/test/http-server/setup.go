@@ -32,7 +32,7 @@ func initBrowsh() {
 func waitUntilConnectedToWebExtension(maxTime time.Duration) {
 	start := time.Now()
 	for time.Since(start) < maxTime {
-		if browsh.IsConnectedToWebExtension {
+		if browsh.IsConnectedToWebExtension() {
 			return
 		}
 		time.Sleep(50 * time.Millisecond)
@@ -56,6 +56,12 @@ func getPath(path string, mode string) string {
 	if mode == "dom" {
 		request.Header.Add("X-Browsh-Raw-Mode", "DOM")
 	}
+	if mode == "markdown" {
+		request.Header.Add("X-Browsh-Raw-Mode", "MARKDOWN")
+	}
+	if mode == "links" {
+		request.Header.Add("X-Browsh-Raw-Mode", "LINKS")
+	}
 	response, err := client.Do(request)
 	if err != nil {
 		panic(fmt.Sprintf("%s", err))
@@ -71,7 +77,6 @@ func getPath(path string, mode string) string {
 }
 
 func stopFirefox() {
-	browsh.IsConnectedToWebExtension = false
 	browsh.Shell(rootDir + "/webext/contrib/firefoxheadless.sh kill")
 	time.Sleep(500 * time.Millisecond)
 }
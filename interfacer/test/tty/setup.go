@@ -237,7 +237,6 @@ func initBrowsh() {
 
 func stopFirefox() {
 	slog.Info("Attempting to kill all firefox processes")
-	browsh.IsConnectedToWebExtension = false
 	browsh.Shell(rootDir + "/webext/contrib/firefoxheadless.sh kill")
 	time.Sleep(500 * time.Millisecond)
 }
@@ -1,23 +1,38 @@
 import stripAnsi from "strip-ansi";
+import { encode } from "background/protocol";
 
 // Here we keep the public functions used to mediate communications between
 // the background process, tabs and the terminal.
 export default (MixinBase) =>
   class extends MixinBase {
-    sendToCurrentTab(message) {
-      if (this.currentTab().channel === undefined) {
-        this.log(`Attempt to send "${message}" to tab without a channel`);
+    sendToCurrentTab(command, payload) {
+      this.sendToTab(this.currentTab(), command, payload);
+    }
+
+    sendToTab(tab, command, payload) {
+      if (tab === undefined || tab.channel === undefined) {
+        this.log(`Attempt to send "${command}" to tab without a channel`);
       } else {
-        this.currentTab().channel.postMessage(message);
+        tab.channel.postMessage(encode(command, payload));
       }
     }
 
-    sendToTerminal(message) {
+    // `fields` can have a `tab_id` and a `correlation_id`, see `background/protocol`
+    sendToTerminal(command, payload, fields = {}) {
+      this._sendEnvelopeToTerminal(encode(command, payload, fields));
+    }
+
+    // For tabs' frames, which are already envelopes, or binary
+    forwardToTerminal(message) {
+      this._sendEnvelopeToTerminal(message);
+    }
+
+    _sendEnvelopeToTerminal(envelope) {
       if (this.terminal === undefined) {
         return;
       }
       if (this.terminal.readyState === 1) {
-        this.terminal.send(message);
+        this.terminal.send(envelope);
       }
     }
 
@@ -30,7 +45,7 @@ export default (MixinBase) =>
         messages = stripAnsi(messages);
         messages = messages.replace(/\u001b\[/g, "ESC");
       }
-      this.sendToTerminal(messages);
+      this.sendToTerminal("/log", { message: messages.toString() });
     }
 
     currentTab() {
@@ -0,0 +1,165 @@
+// The first 12 bytes of an IPv4 address mapped into IPv6, ie; `::ffff:0:0/96`
+const IPV4_MAPPED_PREFIX = [0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0xff, 0xff];
+
+// Stops pages rendered by the HTTP server from loading anything from private
+// networks, such as `localhost` or a cloud provider's metadata service. The CLI
+// client already checks the URL it's asked to render, but pages can still
+// redirect, or make their own requests, to anywhere. Hosts are resolved with
+// Firefox's own DNS cache, so that the answer is the same one that Firefox
+// connects to.
+//
+// All addresses are compared as 16 bytes, with IPv4 addresses mapped into IPv6,
+// so that `::ffff:127.0.0.1` is just as private as `127.0.0.1`.
+export default class {
+  constructor(config) {
+    this.blocked_ranges = this._parseRanges(
+      config["blocked-destination-ranges"]
+    );
+    this.allowed_ranges = this._parseRanges(config["allowed-destinations"]);
+    this.allowed_hosts = (config["allowed-destinations"] || []).map((host) =>
+      host.toLowerCase()
+    );
+  }
+
+  // Resolves to whether the URL can be loaded
+  isAllowed(url) {
+    const host = new URL(url).hostname.replace(/^\[|\]$/g, "").toLowerCase();
+    if (this.allowed_hosts.includes(host)) {
+      return Promise.resolve(true);
+    }
+    if (parseIP(host)) {
+      return Promise.resolve(!this.isPrivate(host));
+    }
+    return browser.dns.resolve(host).then(
+      (record) =>
+        record.addresses.every((address) => !this.isPrivate(address)),
+      // Firefox wouldn't be able to load it either
+      () => false
+    );
+  }
+
+  isPrivate(address) {
+    const ip = parseIP(address);
+    if (!ip) {
+      return true;
+    }
+    return (
+      this.blocked_ranges.some((range) => isInRange(ip, range)) &&
+      !this.allowed_ranges.some((range) => isInRange(ip, range))
+    );
+  }
+
+  // Host names in `allowed-destinations` aren't ranges, so they're skipped
+  _parseRanges(values) {
+    return (values || []).map(parseRange).filter((range) => range !== null);
+  }
+}
+
+// The same check as the CLI client's `isAllowedURL()` for API keys. No domains means
+// anywhere is allowed, otherwise each domain also allows all of its subdomains.
+export function isAllowedDomain(url, domains) {
+  if (!domains || domains.length === 0) {
+    return true;
+  }
+  let host;
+  try {
+    host = new URL(url).hostname.toLowerCase();
+  } catch (_e) {
+    return false;
+  }
+  return domains.some((domain) => {
+    domain = domain.replace(/^\*\./, "").toLowerCase();
+    return host === domain || host.endsWith("." + domain);
+  });
+}
+
+// Either "10.0.0.0/8" or a single address, which is a range of just itself
+export function parseRange(value) {
+  const [address, bits] = value.split("/");
+  const ip = parseIP(address);
+  if (!ip) {
+    return null;
+  }
+  const is_ipv4 = !address.includes(":");
+  let prefix = bits === undefined ? 128 : parseInt(bits, 10);
+  if (bits !== undefined && is_ipv4) {
+    prefix += 96;
+  }
+  if (isNaN(prefix) || prefix < 0 || prefix > 128) {
+    return null;
+  }
+  return { ip: ip, prefix: prefix };
+}
+
+export function isInRange(ip, range) {
+  for (let bit = 0; bit < range.prefix; bit++) {
+    const byte = Math.floor(bit / 8);
+    const mask = 0x80 >> (bit % 8);
+    if ((ip[byte] & mask) !== (range.ip[byte] & mask)) {
+      return false;
+    }
+  }
+  return true;
+}
+
+// Returns the address as 16 bytes, or null if it isn't an IP address
+export function parseIP(address) {
+  address = address.split("%")[0];
+  if (!address.includes(":")) {
+    const ipv4 = parseIPv4(address);
+    return ipv4 ? IPV4_MAPPED_PREFIX.concat(ipv4) : null;
+  }
+  return parseIPv6(address);
+}
+
+function parseIPv4(address) {
+  const parts = address.split(".");
+  if (parts.length !== 4) {
+    return null;
+  }
+  const bytes = parts.map((part) =>
+    /^[0-9]{1,3}$/.test(part) ? parseInt(part, 10) : NaN
+  );
+  return bytes.every((byte) => byte <= 255) ? bytes : null;
+}
+
+function parseIPv6(address) {
+  const halves = address.split("::");
+  if (halves.length > 2) {
+    return null;
+  }
+  const head = parseIPv6Groups(halves[0]);
+  const tail = halves.length === 2 ? parseIPv6Groups(halves[1]) : [];
+  if (!head || !tail) {
+    return null;
+  }
+  const missing = 16 - head.length - tail.length;
+  if (missing < 0 || (halves.length === 1 && missing !== 0)) {
+    return null;
+  }
+  return head.concat(new Array(missing).fill(0), tail);
+}
+
+// Groups of hex, where the last one can be an embedded IPv4 address
+function parseIPv6Groups(groups) {
+  if (groups === "") {
+    return [];
+  }
+  let bytes = [];
+  const parts = groups.split(":");
+  for (let i = 0; i < parts.length; i++) {
+    if (i === parts.length - 1 && parts[i].includes(".")) {
+      const ipv4 = parseIPv4(parts[i]);
+      if (!ipv4) {
+        return null;
+      }
+      return bytes.concat(ipv4);
+    }
+    if (!/^[0-9a-f]{1,4}$/i.test(parts[i])) {
+      return null;
+    }
+    const group = parseInt(parts[i], 16);
+    bytes.push(group >> 8, group & 0xff);
+  }
+  return bytes;
+}
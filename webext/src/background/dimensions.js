@@ -62,14 +62,9 @@ export default class extends utils.mixins(CommonMixin) {
       );
       return;
     }
-    // Does this include scrollbars???
-    const window_width = parseInt(Math.round(this.tty.width * this.char.width));
-    // Leave room for tabs and URL bar
-    const tty_dom_height = this.tty.height - 2;
-    const window_height = parseInt(
-      Math.round(
-        (tty_dom_height + this._window_ui_magic_number) * this.char.height
-      )
+    const [window_width, window_height] = this.windowSizeFor(
+      this.tty.width,
+      this.tty.height
     );
     const current_window = browser.windows.getCurrent();
     current_window.then(
@@ -86,6 +81,23 @@ export default class extends utils.mixins(CommonMixin) {
     );
   }
 
+  // The size in pixels of a browser window that fits the given TTY dimensions
+  windowSizeFor(tty_width, tty_height) {
+    if (!this.char.width || !this.char.height) {
+      return [undefined, undefined];
+    }
+    // Does this include scrollbars???
+    const window_width = parseInt(Math.round(tty_width * this.char.width));
+    // Leave room for tabs and URL bar
+    const tty_dom_height = tty_height - 2;
+    const window_height = parseInt(
+      Math.round(
+        (tty_dom_height + this._window_ui_magic_number) * this.char.height
+      )
+    );
+    return [window_width, window_height];
+  }
+
   _sendWindowResizeRequest(active_window, width, height) {
     const tag = "Resizing browser window";
     const updating = browser.windows.update(active_window.id, {
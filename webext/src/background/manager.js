@@ -4,6 +4,8 @@ import CommonMixin from "background/common_mixin";
 import TTYCommandsMixin from "background/tty_commands_mixin";
 import Tab from "background/tab";
 import Dimensions from "background/dimensions";
+import { PROTOCOL_VERSION } from "background/protocol";
+import { isAllowedDomain } from "background/destination_policy";
 
 // Boots the background process. Mainly involves connecting to the websocket server
 // launched by the Browsh CLI client and setting up listeners for new tabs that
@@ -30,6 +32,8 @@ export default class extends utils.mixins(CommonMixin, TTYCommandsMixin) {
     // Listen to HTTP requests. This allows us to display some helpful status messages at the
     // bottom of the page, eg; "Loading https://coolwebsite.com..."
     this._addWebRequestListener();
+    // In HTTP server mode, pages can't load anything from private networks
+    this._addDestinationPolicyListener();
     // The manager is the hub between tabs and the terminal. First we connect to the
     // terminal, as that is the process that would have initially booted the browser and
     // this very code that now runs.
@@ -37,19 +41,45 @@ export default class extends utils.mixins(CommonMixin, TTYCommandsMixin) {
   }
 
   _connectToTerminal() {
-    // This is the websocket server run by the CLI client
-    this.terminal = new WebSocket("ws://localhost:3334");
-    this.terminal.addEventListener("open", (_event) => {
-      this.log("Webextension connected to the terminal's websocket server");
-      this.dimensions.terminal = this.terminal;
-      this._listenForTerminalMessages();
-      this._connectToBrowserDOM();
-    });
-    this.terminal.addEventListener("close", (_event) => {
-      this._reconnectToTerminal();
+    this._getTerminalURL().then((url) => {
+      this.terminal = new WebSocket(url);
+      this.terminal.addEventListener("open", (_event) => {
+        this.sendToTerminal("/hello", {
+          protocol_version: PROTOCOL_VERSION,
+          browsh_version: browser.runtime.getManifest().version,
+        });
+        this.log("Webextension connected to the terminal's websocket server");
+        this.dimensions.terminal = this.terminal;
+        this._listenForTerminalMessages();
+        this._connectToBrowserDOM();
+      });
+      this.terminal.addEventListener("close", (_event) => {
+        this._reconnectToTerminal();
+      });
     });
   }
 
+  // This is the websocket server run by the CLI client. It puts its address in our
+  // managed storage when it starts, along with the token that it only accepts
+  // connections with. Its default address is IPv4's loopback address, which
+  // "localhost" may not resolve to.
+  _getTerminalURL() {
+    const default_url = "ws://127.0.0.1:3334/";
+    return browser.storage.managed
+      .get(["websocket_token", "websocket_url"])
+      .then(
+        (storage) => {
+          const url = storage.websocket_url || default_url;
+          const token = storage.websocket_token || "";
+          return url + "?token=" + encodeURIComponent(token);
+        },
+        (error) => {
+          this.log("Couldn't read the terminal's websocket address: " + error);
+          return default_url;
+        },
+      );
+  }
+
   // If we've disconnected from the terminal, but we're still running, then that likely
   // means the terminal crashed, so we wait to see if the user restarts the terminal.
   _reconnectToTerminal() {
@@ -166,6 +196,8 @@ export default class extends utils.mixins(CommonMixin, TTYCommandsMixin) {
       "active",
       "request_id",
       "raw_text_mode_type",
+      "render_options",
+      "has_own_window",
       "start_time",
     ].map((key) => {
       if (tabish_object.hasOwnProperty(key)) {
@@ -299,4 +331,52 @@ export default class extends utils.mixins(CommonMixin, TTYCommandsMixin) {
       ["blocking"]
     );
   }
+
+  // Redirects and the page's own requests go through here too, so the policy is
+  // enforced on more than just the URL that was asked for.
+  _addDestinationPolicyListener() {
+    browser.webRequest.onBeforeRequest.addListener(
+      (e) => this._checkDestination(e),
+      {
+        urls: ["*://*/*"],
+      },
+      ["blocking"]
+    );
+  }
+
+  _checkDestination(e) {
+    // Requests that don't belong to a tab are Browsh's own
+    if (e.tabId < 0) {
+      return;
+    }
+    if (e.type == "main_frame" && !this._isAllowedByAPIKey(e)) {
+      this.log(`Blocked navigation outside of the API key's domains: ${e.url}`);
+      this._blockRawTextRequest(e.tabId, "allowed_domains");
+      return { cancel: true };
+    }
+    if (!this.destination_policy) {
+      return;
+    }
+    return this.destination_policy.isAllowed(e.url).then((is_allowed) => {
+      if (is_allowed) {
+        return {};
+      }
+      this.log(`Blocked request to a private network: ${e.url}`);
+      if (e.type == "main_frame") {
+        this._blockRawTextRequest(e.tabId, "private_network");
+      }
+      return { cancel: true };
+    });
+  }
+
+  // The CLI client only checks the URL that its client asked for, but the page can
+  // redirect, or navigate, anywhere. Only the page itself is limited to the API key's
+  // domains, not what it loads.
+  _isAllowedByAPIKey(e) {
+    const tab = this.tabs[e.tabId];
+    if (!tab || !tab.render_options) {
+      return true;
+    }
+    return isAllowedDomain(e.url, tab.render_options.allowed_domains);
+  }
 }
@@ -0,0 +1,35 @@
+// Messages between the background process and the Browsh CLI client are JSON
+// envelopes, eg;
+//   {"version": 1, "command": "/new_tab", "payload": {"url": "https://www.brow.sh"}}
+// Envelopes can also have a `tab_id`, for commands about a particular tab, and a
+// `correlation_id`, for matching up a response to its request, like with raw text.
+// Messages between the background process and tabs are envelopes too, apart from
+// binary frames.
+//
+// The version must be bumped whenever either side changes how it reads or writes
+// messages, so that a webextension and CLI client from different releases can tell.
+export const PROTOCOL_VERSION = 1;
+
+export function encode(command, payload, fields = {}) {
+  let envelope = { version: PROTOCOL_VERSION, command: command };
+  Object.assign(envelope, fields);
+  if (payload !== undefined) {
+    envelope.payload = payload;
+  }
+  return JSON.stringify(envelope);
+}
+
+// Encoded envelopes always start with their version and command, so that the
+// background process can pass on a tab's frames without parsing them
+export function commandOf(message) {
+  const match = /^\{"version":\d+,"command":"([^"]*)"/.exec(message);
+  return match ? match[1] : undefined;
+}
+
+export function decode(message) {
+  const envelope = JSON.parse(message);
+  if (envelope.payload === undefined) {
+    envelope.payload = {};
+  }
+  return envelope;
+}
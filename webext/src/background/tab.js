@@ -1,5 +1,8 @@
+import _ from "lodash";
+
 import utils from "utils";
 
+import { encode } from "background/protocol";
 import CommonMixin from "background/common_mixin";
 import TabCommandsMixin from "background/tab_commands_mixin";
 
@@ -12,6 +15,12 @@ export default class extends utils.mixins(CommonMixin, TabCommandsMixin) {
     this._max_number_of_tab_recovery_reloads = 3;
     // Type of raw text mode; HTML or plain
     this.raw_text_mode_type = "";
+    // Per-request overrides of the `[http-server]` config
+    this.render_options = {};
+    // Raw text requests with custom dimensions get a browser window to themselves
+    this.has_own_window = false;
+    // Whether pages in this tab are stripped down to just their main article
+    this.reader_mode = false;
   }
 
   postDOMLoadInit(terminal, dimensions) {
@@ -86,7 +95,9 @@ export default class extends utils.mixins(CommonMixin, TabCommandsMixin) {
   }
 
   sendStateToTerminal() {
-    this.sendToTerminal(`/tab_state,${JSON.stringify(this.getStateObject())}`);
+    this.sendToTerminal("/tab_state", this.getStateObject(), {
+      tab_id: this.id,
+    });
   }
 
   // For various reasons a tab's content script doesn't always load. Currently
@@ -114,10 +125,12 @@ export default class extends utils.mixins(CommonMixin, TabCommandsMixin) {
   }
 
   sendGlobalConfig(config) {
+    config = this._applyRenderOptions(config);
     config.http_server_mode_type = this._calculateMode();
     config.start_time = this.start_time;
+    config.reader_mode = this.reader_mode;
     if (this.channel) {
-      this.channel.postMessage(`/config,${JSON.stringify(config)}`);
+      this.channel.postMessage(encode("/config", config));
     } else {
       setTimeout(() => {
         this.sendGlobalConfig(config);
@@ -125,13 +138,23 @@ export default class extends utils.mixins(CommonMixin, TabCommandsMixin) {
     }
   }
 
+  _applyRenderOptions(config) {
+    if (_.isEmpty(this.render_options)) {
+      return config;
+    }
+    return _.merge({}, config, { "http-server": this.render_options });
+  }
+
   _listenForMessages() {
     this.channel.onMessage.addListener(this.handleTabMessage.bind(this));
   }
 
   _sendTTYDimensions() {
     this.channel.postMessage(
-      `/tty_size,${this.dimensions.tty.width},${this.dimensions.tty.height}`
+      encode("/tty_size", {
+        width: this.dimensions.tty.width,
+        height: this.dimensions.tty.height,
+      }),
     );
   }
 
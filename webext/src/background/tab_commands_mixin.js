@@ -1,42 +1,43 @@
-import utils from "utils";
+import { commandOf, decode } from "background/protocol";
 
 // Handle commands from tabs, like sending a frame or information about
 // the current character dimensions.
 export default (MixinBase) =>
   class extends MixinBase {
-    // TODO: There needs to be some consistency in this message sending protocol.
-    //       Eg; always requiring JSON.
     handleTabMessage(message) {
-      let incoming;
-      const parts = message.split(",");
-      const command = parts[0];
-      switch (command) {
+      // Only frames are binary, and they're passed on as they are
+      if (typeof message !== "string") {
+        this.forwardToTerminal(message);
+        return;
+      }
+      // Frames are already what the terminal expects, and are too big to parse only to
+      // pass them on
+      switch (commandOf(message)) {
         case "/frame_text":
-          this.sendToTerminal(`/frame_text,${message.slice(12)}`);
-          break;
         case "/frame_pixels":
-          this.sendToTerminal(`/frame_pixels,${message.slice(14)}`);
-          break;
+          this.forwardToTerminal(message);
+          return;
+      }
+      const envelope = decode(message);
+      const payload = envelope.payload;
+      switch (envelope.command) {
         case "/tab_info":
-          incoming = JSON.parse(utils.rebuildArgsToSingleArg(parts));
-          this._updateTabInfo(incoming);
+          this._updateTabInfo(payload);
           break;
         case "/dimensions":
-          incoming = JSON.parse(message.slice(12));
-          this.dimensions.setCharValues(incoming.char);
+          this.dimensions.setCharValues(payload.char);
           break;
         case "/status":
-          this.updateStatus(parts[1], parts[2]);
+          this.updateStatus(payload.status, payload.message);
           break;
         case "/log":
-          this.log(message.slice(5));
+          this.log(JSON.stringify(payload.messages));
           break;
         case "/raw_text":
-          incoming = JSON.parse(utils.rebuildArgsToSingleArg(parts));
-          this._rawTextRequest(incoming);
+          this._rawTextRequest(payload);
           break;
         default:
-          this.log("Unknown command from tab to background", message);
+          this.log(`Unknown command from tab to background: ${envelope.command}`);
       }
     }
 
@@ -51,11 +52,13 @@ export default (MixinBase) =>
       // automatic startup URL loading, which should now be disabled for HTTP Server
       // mode.
       if (this.request_id) {
-        let payload = {
-          json: JSON.stringify(incoming),
-          request_id: this.request_id,
-        };
-        this.sendToTerminal(`/raw_text,${JSON.stringify(payload)}`);
+        this.sendToTerminal("/raw_text", incoming, {
+          correlation_id: this.request_id,
+        });
+      }
+      if (this.has_own_window) {
+        this.remove();
+        return;
       }
       this._tabCount((count) => {
         if (count > 1) {
@@ -1,47 +1,78 @@
-import utils from "utils";
+import DestinationPolicy from "background/destination_policy";
+import { decode, PROTOCOL_VERSION } from "background/protocol";
 
 // Handle commands coming in from the terminal, like; STDIN keystrokes, TTY resize, etc
 export default (MixinBase) =>
   class extends MixinBase {
     handleTerminalMessage(message) {
-      const parts = message.split(",");
-      const command = parts[0];
-      switch (command) {
+      const envelope = decode(message);
+      const payload = envelope.payload;
+      switch (envelope.command) {
+        case "/hello":
+          this._checkTerminalVersion(payload);
+          break;
         case "/config":
-          this._loadConfig(message.slice(8));
+          this._loadConfig(payload);
           break;
         case "/tab_command":
-          this.sendToCurrentTab(message.slice(13));
+          this.sendToTab(
+            this.tabs[envelope.tab_id],
+            payload.command,
+            payload.payload,
+          );
           break;
         case "/tty_size":
-          this._updateTTYSize(parts[1], parts[2]);
+          this._updateTTYSize(payload.width, payload.height);
           break;
         case "/stdin":
-          this._handleUICommand(parts);
-          this.sendToCurrentTab(message);
+          this._handleUICommand(payload);
+          this.sendToCurrentTab("/stdin", payload);
           break;
         case "/url_bar":
-          this._handleURLBarInput(parts.slice(1).join(","));
+          this._handleURLBarInput(payload.input);
           break;
         case "/new_tab":
-          this.createNewTab(parts.slice(1).join(","));
+          this.createNewTab(payload.url);
           break;
         case "/switch_to_tab":
-          this.switchToTab(parts.slice(1).join(","));
+          this.switchToTab(envelope.tab_id);
           break;
         case "/remove_tab":
-          this.removeTab(parts.slice(1).join(","));
+          this.removeTab(envelope.tab_id);
+          break;
+        case "/status":
+          if (this.currentTab()) {
+            this.currentTab().updateStatus("info", payload.message);
+          }
           break;
         case "/raw_text_request":
-          this._rawTextRequest(parts[1], parts[2], parts.slice(3).join(","));
+          this._rawTextRequest(payload, envelope.correlation_id);
+          break;
+        case "/raw_text_abort":
+          this._abortRawTextRequest(envelope.correlation_id);
           break;
+        default:
+          this.log(`Unknown command from terminal: ${envelope.command}`);
+      }
+    }
+
+    // The terminal does the same check, and warns the user, so this is just for the logs
+    _checkTerminalVersion(hello) {
+      // Terminals from before binary frames don't say anything about them
+      this.binary_frames = hello.binary_frames === true;
+      if (hello.protocol_version !== PROTOCOL_VERSION) {
+        this.log(
+          `Terminal uses message protocol version ${hello.protocol_version}, ` +
+            `but the webextension uses version ${PROTOCOL_VERSION}`,
+        );
       }
     }
 
-    _loadConfig(json_string) {
-      this.log(json_string);
-      this.config = JSON.parse(json_string);
+    _loadConfig(config) {
+      this.log(JSON.stringify(config));
+      this.config = config;
       this.config.browsh_version = browser.runtime.getManifest().version;
+      this.config.binary_frames = this.binary_frames === true;
       if (this.currentTab()) {
         this.currentTab().sendGlobalConfig(this.config);
       }
@@ -54,6 +85,10 @@ export default (MixinBase) =>
         return;
       }
       this._is_raw_text_mode = true;
+      const http_server_config = this.config["http-server"] || {};
+      this.destination_policy = http_server_config["block-private-destinations"]
+        ? new DestinationPolicy(http_server_config)
+        : null;
       this._updateTTYSize(
         this.dimensions.raw_text_tty_size.width,
         this.dimensions.raw_text_tty_size.height
@@ -64,9 +99,10 @@ export default (MixinBase) =>
       this.dimensions.tty.width = parseInt(width);
       this.dimensions.tty.height = parseInt(height);
       if (this.currentTab()) {
-        this.sendToCurrentTab(
-          `/tty_size,${this.dimensions.tty.width},${this.dimensions.tty.height}`
-        );
+        this.sendToCurrentTab("/tty_size", {
+          width: this.dimensions.tty.width,
+          height: this.dimensions.tty.height,
+        });
       }
       this.log(
         `Requesting browser resize for new TTY dimensions: ` +
@@ -75,8 +111,7 @@ export default (MixinBase) =>
       this.dimensions.resizeBrowserWindow();
     }
 
-    _handleUICommand(parts) {
-      const input = JSON.parse(utils.rebuildArgsToSingleArg(parts));
+    _handleUICommand(input) {
       // CTRL mappings
       /*
       if (input.mod === 2) {
@@ -94,6 +129,9 @@ export default (MixinBase) =>
           case "u":
             this.toggleUserAgent();
             break;
+          case "r":
+            this.toggleReaderMode();
+            break;
         }
       }
       return false;
@@ -188,15 +226,18 @@ export default (MixinBase) =>
 
     _saveScreenshot(imageUri) {
       const data = imageUri.replace(/^data:image\/\w+;base64,/, "");
-      this.sendToTerminal("/screenshot," + data);
+      this.sendToTerminal("/screenshot", { data: data });
     }
 
-    _rawTextRequest(request_id, mode, url) {
-      this.createNewTab(url, (native_tab) => {
+    _rawTextRequest(request, request_id) {
+      const options = request.options || {};
+      const callback = (native_tab, has_own_window = false) => {
         this._acknowledgeNewTab({
           id: native_tab.id,
           request_id: request_id,
-          raw_text_mode_type: mode.toLowerCase(),
+          raw_text_mode_type: request.mode.toLowerCase(),
+          render_options: options,
+          has_own_window: has_own_window,
           start_time: Date.now(),
         });
         // Sometimes tabs fail to load for whatever reason. Make sure they get
@@ -206,7 +247,62 @@ export default (MixinBase) =>
             this.removeTab(native_tab.id);
           }
         }, 60000);
+      };
+      if (options.columns || options.rows) {
+        this._createRawTextWindow(request.url, options, callback);
+      } else {
+        this.createNewTab(request.url, callback);
+      }
+    }
+
+    // All tabs in a window share the same width, so a request for different dimensions
+    // needs a window of its own.
+    _createRawTextWindow(url, options, callback) {
+      const [width, height] = this.dimensions.windowSizeFor(
+        options.columns || this.dimensions.raw_text_tty_size.width,
+        options.rows || this.dimensions.raw_text_tty_size.height
+      );
+      if (!width || !height) {
+        this.log(
+          "Character dimensions not known yet, using the default window"
+        );
+        this.createNewTab(url, callback);
+        return;
+      }
+      let creating = browser.windows.create({
+        url: this._getURLfromUserInput(url),
+        width: width,
+        height: height,
       });
+      creating.then(
+        (new_window) => callback(new_window.tabs[0], true),
+        (error) => this.log(`Error creating new window: ${error}`)
+      );
+    }
+
+    // The HTTP client gave up waiting, so there's no point in carrying on with the page
+    _abortRawTextRequest(request_id) {
+      for (const id in this.tabs) {
+        if (this.tabs[id] && this.tabs[id].request_id === request_id) {
+          this.log(`Aborting raw text request ${request_id} in tab ${id}`);
+          this.removeTab(id);
+        }
+      }
+    }
+
+    // The page tried to go somewhere that it's not allowed to, so there's
+    // nothing to render. The reason is either "private_network" or "allowed_domains".
+    _blockRawTextRequest(tab_id, reason) {
+      const tab = this.tabs[tab_id];
+      if (tab && tab.request_id) {
+        this.log(`Blocked raw text request ${tab.request_id} in tab ${tab_id}`);
+        this.sendToTerminal(
+          "/raw_text_blocked",
+          { reason: reason },
+          { correlation_id: tab.request_id },
+        );
+        this.removeTab(tab_id);
+      }
     }
 
     toggleUserAgent() {
@@ -218,6 +314,14 @@ export default (MixinBase) =>
       this.currentTab().updateStatus("info", message);
     }
 
+    // Reader mode belongs to the tab, so it stays on as the tab navigates to
+    // other pages.
+    toggleReaderMode() {
+      let tab = this.currentTab();
+      tab.reader_mode = !tab.reader_mode;
+      this.sendToCurrentTab("/reader_mode", { enabled: tab.reader_mode });
+    }
+
     _addUserAgentListener() {
       browser.webRequest.onBeforeSendHeaders.addListener(
         (e) => {
@@ -0,0 +1,128 @@
+// Frames as compact binary, rather than JSON, which the CLI client can parse much more
+// quickly. Only used when the CLI client says that it can read them. See
+// `interfacer/src/browsh/frame_binary.go` for the layout, which must be changed in step.
+const TEXT_FRAME = 1;
+const PIXELS_FRAME = 2;
+const VERSION = 1;
+const PACKED_COLOURS = 0;
+const RUN_LENGTH_COLOURS = 1;
+const META_FIELDS = [
+  "id",
+  "sub_width",
+  "sub_height",
+  "sub_left",
+  "sub_top",
+  "total_width",
+  "total_height",
+];
+const HEADER_LENGTH = 2 + META_FIELDS.length * 4;
+
+export function encodeTextFrame(frame) {
+  const encoder = new TextEncoder();
+  const colours = encodeColours(frame.colours);
+  const text = _encodeText(frame.text, encoder);
+  const input_boxes = encoder.encode(JSON.stringify(frame.input_boxes || {}));
+  const writer = new _Writer(
+    HEADER_LENGTH +
+      5 +
+      colours.data.length +
+      4 +
+      text.length +
+      4 +
+      input_boxes.length,
+  );
+  writer.header(TEXT_FRAME, frame.meta);
+  writer.colours(colours);
+  writer.block(text);
+  writer.block(input_boxes);
+  return writer.buffer;
+}
+
+export function encodePixelsFrame(frame) {
+  const colours = encodeColours(frame.colours);
+  const writer = new _Writer(HEADER_LENGTH + 5 + colours.data.length);
+  writer.header(PIXELS_FRAME, frame.meta);
+  writer.colours(colours);
+  return writer.buffer;
+}
+
+// Pages tend to have big blocks of the same colour, so runs of colours are usually much
+// smaller than every colour. Pages like photos don't though, so whichever is smaller is
+// used.
+export function encodeColours(colours) {
+  const runs = new Uint8Array((colours.length / 3) * 4);
+  let length = 0;
+  for (let i = 0; i < colours.length; i += 3) {
+    const is_same_as_run =
+      length > 0 &&
+      runs[length - 4] < 255 &&
+      runs[length - 3] === colours[i] &&
+      runs[length - 2] === colours[i + 1] &&
+      runs[length - 1] === colours[i + 2];
+    if (is_same_as_run) {
+      runs[length - 4]++;
+    } else {
+      runs[length] = 1;
+      runs[length + 1] = colours[i];
+      runs[length + 2] = colours[i + 1];
+      runs[length + 3] = colours[i + 2];
+      length += 4;
+    }
+  }
+  if (length < colours.length) {
+    return { encoding: RUN_LENGTH_COLOURS, data: runs.subarray(0, length) };
+  }
+  return { encoding: PACKED_COLOURS, data: Uint8Array.from(colours) };
+}
+
+// Each cell's UTF-8 is prefixed by its length. A cell is a single character, so it
+// won't ever be longer than 255 bytes.
+function _encodeText(text, encoder) {
+  const cells = text.map((cell) => encoder.encode(cell).subarray(0, 255));
+  const length = cells.reduce((total, cell) => total + 1 + cell.length, 0);
+  const encoded = new Uint8Array(length);
+  let offset = 0;
+  for (const cell of cells) {
+    encoded[offset] = cell.length;
+    encoded.set(cell, offset + 1);
+    offset += 1 + cell.length;
+  }
+  return encoded;
+}
+
+class _Writer {
+  constructor(length) {
+    this.buffer = new ArrayBuffer(length);
+    this._view = new DataView(this.buffer);
+    this._bytes = new Uint8Array(this.buffer);
+    this._offset = 0;
+  }
+
+  header(kind, meta) {
+    this._uint8(kind);
+    this._uint8(VERSION);
+    META_FIELDS.forEach((field) => this._int32(meta[field]));
+  }
+
+  colours(colours) {
+    this._uint8(colours.encoding);
+    this.block(colours.data);
+  }
+
+  // Bytes prefixed by their length
+  block(bytes) {
+    this._view.setUint32(this._offset, bytes.length, true);
+    this._bytes.set(bytes, this._offset + 4);
+    this._offset += 4 + bytes.length;
+  }
+
+  _uint8(value) {
+    this._view.setUint8(this._offset, value);
+    this._offset += 1;
+  }
+
+  _int32(value) {
+    this._view.setInt32(this._offset, value, true);
+    this._offset += 4;
+  }
+}
@@ -1,15 +1,13 @@
-import utils from "utils";
+import { decode } from "background/protocol";
 
 export default (MixinBase) =>
   class extends MixinBase {
     _handleBackgroundMessage(message) {
-      let input, url, config;
-      const parts = message.split(",");
-      const command = parts[0];
-      switch (command) {
+      const envelope = decode(message);
+      const payload = envelope.payload;
+      switch (envelope.command) {
         case "/config":
-          config = JSON.parse(utils.rebuildArgsToSingleArg(parts));
-          this._loadConfig(config);
+          this._loadConfig(payload);
           break;
         case "/request_frame":
           this.sendFrame();
@@ -20,22 +18,19 @@ export default (MixinBase) =>
           }
           break;
         case "/scroll_status":
-          this._handleScroll(parts[1], parts[2]);
+          this._handleScroll(payload.x, payload.y);
           break;
         case "/tty_size":
-          this._handleTTYSize(parts[1], parts[2]);
+          this._handleTTYSize(payload.width, payload.height);
           break;
         case "/stdin":
-          input = JSON.parse(utils.rebuildArgsToSingleArg(parts));
-          this._handleUserInput(input);
+          this._handleUserInput(payload);
           break;
         case "/input_box":
-          input = JSON.parse(utils.rebuildArgsToSingleArg(parts));
-          this._handleInputBoxContent(input);
+          this._handleInputBoxContent(payload);
           break;
         case "/url":
-          url = utils.rebuildArgsToSingleArg(parts);
-          document.location.href = url;
+          document.location.href = payload.url;
           break;
         case "/history_back":
           history.go(-1);
@@ -43,8 +38,11 @@ export default (MixinBase) =>
         case "/window_stop":
           window.stop();
           break;
+        case "/reader_mode":
+          this.setReaderMode(payload.enabled);
+          break;
         default:
-          this.log("Unknown command sent to tab", message);
+          this.log("Unknown command sent to tab", envelope.command);
       }
     }
 
@@ -86,9 +84,10 @@ export default (MixinBase) =>
           state = !state;
           this.config.browsh.use_experimental_text_visibility = state;
           message = state ? "on" : "off";
-          this.sendMessage(
-            `/status,info,Experimental text visibility: ${message}`
-          );
+          this.sendMessage("/status", {
+            status: "info",
+            message: `Experimental text visibility: ${message}`,
+          });
           this.sendSmallTextFrame();
           break;
       }
@@ -251,7 +250,7 @@ export default (MixinBase) =>
         url: document.location.href,
         title: title_object.length ? title_object[0].innerHTML : "",
       };
-      this.sendMessage(`/tab_info,${JSON.stringify(info)}`);
+      this.sendMessage("/tab_info", info);
     }
 
     _mightSendBigFrames() {
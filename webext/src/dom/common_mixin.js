@@ -1,3 +1,5 @@
+import { encode } from "background/protocol";
+
 export default (MixinBase) =>
   class extends MixinBase {
     constructor() {
@@ -5,11 +7,18 @@ export default (MixinBase) =>
       this._is_first_frame_finished = false;
     }
 
-    sendMessage(message) {
+    sendMessage(command, payload) {
+      if (this.channel == undefined) {
+        return;
+      }
+      this.channel.postMessage(encode(command, payload));
+    }
+
+    sendBinaryMessage(buffer) {
       if (this.channel == undefined) {
         return;
       }
-      this.channel.postMessage(message);
+      this.channel.postMessage(buffer);
     }
 
     log(...messages) {
@@ -17,7 +26,7 @@ export default (MixinBase) =>
         return;
       }
       messages.unshift(this.channel.name);
-      this.sendMessage(`/log,${JSON.stringify(messages)}`);
+      this.sendMessage("/log", { messages: messages });
     }
 
     logPerformance(work, reference) {
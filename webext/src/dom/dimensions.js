@@ -266,6 +266,6 @@ export default class extends utils.mixins(CommonMixin) {
       frame: this.frame,
       char: this.char,
     };
-    this.sendMessage(`/dimensions,${JSON.stringify(dimensions)}`);
+    this.sendMessage("/dimensions", dimensions);
   }
 }
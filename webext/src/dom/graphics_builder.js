@@ -1,6 +1,7 @@
 import utils from "utils";
 
 import CommonMixin from "dom/common_mixin";
+import { encodePixelsFrame } from "dom/binary_frame";
 
 // Converts an instance of the visible DOM into an array of pixel values.
 // Note that it does this both with and without the text visible in order
@@ -226,10 +227,12 @@ export default class extends utils.mixins(CommonMixin) {
 
   _sendFrame() {
     this._serialiseFrame();
-    if (this.frame.colours.length > 0) {
-      this.sendMessage(`/frame_pixels,${JSON.stringify(this.frame)}`);
-    } else {
+    if (this.frame.colours.length === 0) {
       this.log("Not sending empty pixels frame");
+    } else if (this.config.binary_frames) {
+      this.sendBinaryMessage(encodePixelsFrame(this.frame));
+    } else {
+      this.sendMessage("/frame_pixels", this.frame);
     }
   }
 
@@ -239,7 +242,6 @@ export default class extends utils.mixins(CommonMixin) {
     const height = this.dimensions.frame.sub.height;
     for (let y = 0; y < height; y++) {
       for (let x = 0; x < width; x++) {
-        // TODO: Explore sending as binary data
         this._getScaledPixelAt(x, y).map((c) => this.frame.colours.push(c));
       }
     }
@@ -6,6 +6,7 @@ import CommonMixin from "dom/common_mixin";
 import CommandsMixin from "dom/commands_mixin";
 import Dimensions from "dom/dimensions";
 import GraphicsBuilder from "dom/graphics_builder";
+import Reader from "dom/reader";
 import TextBuilder from "dom/text_builder";
 
 // Entrypoint for managing a single tab
@@ -38,6 +39,7 @@ export default class extends utils.mixins(CommonMixin, CommandsMixin) {
       this.graphics_builder,
       this.config
     );
+    this.reader = new Reader(this.config);
   }
 
   _willHideText() {
@@ -56,7 +58,7 @@ export default class extends utils.mixins(CommonMixin, CommandsMixin) {
     this.sendSmallPixelFrame();
     this._sendTabInfo();
     if (!this._is_first_frame_finished) {
-      this.sendMessage("/status,parsing_complete");
+      this.sendMessage("/status", { status: "parsing_complete" });
     }
     this._is_first_frame_finished = true;
   }
@@ -81,6 +83,10 @@ export default class extends utils.mixins(CommonMixin, CommandsMixin) {
 
   sendRawText() {
     if (this.is_page_finished_loading) {
+      if (this._raw_mode_type === "raw_text_reader") {
+        // Pages without an article are just sent as they are
+        this.reader.enable();
+      }
       this.dimensions.update();
       this.dimensions.setSubFrameDimensions("raw_text");
       this.text_builder.sendRawText(this._raw_mode_type);
@@ -118,7 +124,7 @@ export default class extends utils.mixins(CommonMixin, CommandsMixin) {
   _postCommsInit() {
     this.log("Webextension postCommsInit()");
     this._sendTabInfo();
-    this.sendMessage("/status,page_init");
+    this.sendMessage("/status", { status: "page_init" });
     this._listenForBackgroundMessages();
     this._startWindowEventListeners();
   }
@@ -129,6 +135,9 @@ export default class extends utils.mixins(CommonMixin, CommandsMixin) {
   _setupInteractiveMode() {
     this._setupDebouncedFunctions();
     this._startMutationObserver();
+    if (this.config.reader_mode) {
+      this._enableReaderModeOnLoad();
+    }
     this.sendAllBigFrames();
     // TODO:
     //   Disabling CSS transitions is not easy, many pages won't even render
@@ -139,6 +148,30 @@ export default class extends utils.mixins(CommonMixin, CommandsMixin) {
     }, 500);
   }
 
+  // Reader mode sticks to a tab, so new pages need to start in reader mode as
+  // soon as they have some DOM to work with.
+  _enableReaderModeOnLoad() {
+    if (this.is_dom_loaded) {
+      this.setReaderMode(true);
+    } else {
+      setTimeout(this._enableReaderModeOnLoad.bind(this), 1);
+    }
+  }
+
+  setReaderMode(is_on) {
+    let message;
+    if (is_on) {
+      message = this.reader.enable()
+        ? "Reader mode: on"
+        : "Reader mode: no article found on this page";
+    } else {
+      this.reader.disable();
+      message = "Reader mode: off";
+    }
+    this.sendMessage("/status", { status: "info", message: message });
+    this.sendAllBigFrames();
+  }
+
   _setupDebouncedFunctions() {
     this._debouncedSmallTextFrame = _.debounce(this.sendSmallTextFrame, 100, {
       leading: true,
@@ -200,7 +233,7 @@ export default class extends utils.mixins(CommonMixin, CommandsMixin) {
       this.log("PAGE LOADED");
     });
     window.addEventListener("unload", () => {
-      this.sendMessage("/status,window_unload");
+      this.sendMessage("/status", { status: "window_unload" });
     });
     window.addEventListener("error", (error) => {
       this.logError(error);
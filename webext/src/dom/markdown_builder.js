@@ -0,0 +1,265 @@
+// Elements that never contain anything readable
+const SKIPPED_TAGS = [
+  "SCRIPT",
+  "STYLE",
+  "NOSCRIPT",
+  "TEMPLATE",
+  "SVG",
+  "CANVAS",
+  "IFRAME",
+  "HEAD",
+  "BUTTON",
+  "SELECT",
+  "INPUT",
+  "TEXTAREA",
+];
+
+const BLOCK_TAGS = [
+  "ADDRESS",
+  "ARTICLE",
+  "ASIDE",
+  "BODY",
+  "DD",
+  "DETAILS",
+  "DIV",
+  "DL",
+  "DT",
+  "FIELDSET",
+  "FIGCAPTION",
+  "FIGURE",
+  "FOOTER",
+  "FORM",
+  "HEADER",
+  "MAIN",
+  "NAV",
+  "P",
+  "SECTION",
+  "SUMMARY",
+];
+
+// Converts the DOM into Markdown. Unlike the other raw text modes this ignores
+// the rendered layout of the page and instead keeps the document's structure:
+// headings, links, lists, code blocks and tables.
+export default class {
+  build(root) {
+    const markdown = this._blockChildren(root);
+    return this._tidy(markdown) + "\n";
+  }
+
+  _blockChildren(element) {
+    let markdown = "";
+    element.childNodes.forEach((node) => {
+      let converted = this._node(node);
+      // Whitespace at the start of a line is never significant in HTML
+      if (markdown === "" || markdown.endsWith("\n")) {
+        converted = converted.replace(/^[ \t]+/, "");
+      }
+      markdown += converted;
+    });
+    return markdown;
+  }
+
+  _node(node) {
+    if (node.nodeType === 3) {
+      return this._text(node.textContent);
+    }
+    if (node.nodeType !== 1 || this._isSkipped(node)) {
+      return "";
+    }
+    const tag = node.nodeName.toUpperCase();
+    if (/^H[1-6]$/.test(tag)) {
+      return this._heading(node, parseInt(tag[1]));
+    }
+    switch (tag) {
+      case "A":
+        return this._link(node);
+      case "STRONG":
+      case "B":
+        return this._wrapInline(node, "**");
+      case "EM":
+      case "I":
+        return this._wrapInline(node, "*");
+      case "DEL":
+      case "S":
+        return this._wrapInline(node, "~~");
+      case "CODE":
+        return this._inlineCode(node);
+      case "PRE":
+        return this._codeBlock(node);
+      case "BR":
+        return "\\\n";
+      case "HR":
+        return "\n\n---\n\n";
+      case "IMG":
+        return this._image(node);
+      case "UL":
+      case "OL":
+        return this._list(node);
+      case "BLOCKQUOTE":
+        return this._blockquote(node);
+      case "TABLE":
+        return this._table(node);
+    }
+    if (BLOCK_TAGS.includes(tag)) {
+      return "\n\n" + this._blockChildren(node) + "\n\n";
+    }
+    return this._blockChildren(node);
+  }
+
+  _text(text) {
+    return text.replace(/\s+/g, " ");
+  }
+
+  _inline(element) {
+    return this._blockChildren(element).replace(/\s+/g, " ").trim();
+  }
+
+  _heading(element, level) {
+    const text = this._inline(element);
+    if (text === "") {
+      return "";
+    }
+    return "\n\n" + "#".repeat(level) + " " + text + "\n\n";
+  }
+
+  _link(element) {
+    const text = this._inline(element);
+    const href = element.href || element.getAttribute("href");
+    if (!href || href.startsWith("javascript:")) {
+      return text;
+    }
+    if (text === "") {
+      return "";
+    }
+    return `[${text}](${href})`;
+  }
+
+  _wrapInline(element, marker) {
+    const text = this._inline(element);
+    if (text === "") {
+      return "";
+    }
+    return marker + text + marker;
+  }
+
+  _inlineCode(element) {
+    const text = element.textContent;
+    const fence = text.includes("`") ? "``" : "`";
+    return fence + text + fence;
+  }
+
+  _codeBlock(element) {
+    let language = "";
+    const code = element.querySelector ? element.querySelector("code") : null;
+    const class_name = (code || element).getAttribute("class") || "";
+    const match = class_name.match(/(?:language|lang)-(\S+)/);
+    if (match) {
+      language = match[1];
+    }
+    const text = element.textContent.replace(/\n$/, "");
+    return "\n\n```" + language + "\n" + text + "\n```\n\n";
+  }
+
+  _image(element) {
+    const src = element.src || element.getAttribute("src");
+    if (!src) {
+      return "";
+    }
+    const alt = (element.getAttribute("alt") || "").replace(/\s+/g, " ");
+    return `![${alt}](${src})`;
+  }
+
+  // Each item's continuation lines, including any nested lists, are indented to
+  // line up with the item's text.
+  _list(element) {
+    let markdown = "\n\n";
+    let number = parseInt(element.getAttribute("start") || "1");
+    const is_ordered = element.nodeName.toUpperCase() === "OL";
+    element.childNodes.forEach((node) => {
+      if (node.nodeType !== 1 || node.nodeName.toUpperCase() !== "LI") {
+        return;
+      }
+      const marker = is_ordered ? `${number++}. ` : "- ";
+      const indent = " ".repeat(marker.length);
+      const lines = this._tidy(this._blockChildren(node)).split("\n");
+      markdown += marker + lines[0] + "\n";
+      lines.slice(1).forEach((line) => {
+        markdown += (line === "" ? "" : indent + line) + "\n";
+      });
+    });
+    return markdown + "\n";
+  }
+
+  _blockquote(element) {
+    const quote = this._tidy(this._blockChildren(element));
+    const lines = quote.split("\n").map((line) => "> " + line);
+    return "\n\n" + lines.join("\n") + "\n\n";
+  }
+
+  // Tables are converted to GitHub flavoured Markdown, the first row is always
+  // used as the header.
+  _table(element) {
+    let rows = [];
+    element.querySelectorAll("tr").forEach((row) => {
+      let cells = [];
+      row.childNodes.forEach((cell) => {
+        const tag = cell.nodeName.toUpperCase();
+        if (tag === "TD" || tag === "TH") {
+          cells.push(this._inline(cell).replace(/\|/g, "\\|"));
+        }
+      });
+      if (cells.length > 0) {
+        rows.push(cells);
+      }
+    });
+    if (rows.length === 0) {
+      return "";
+    }
+    const width = Math.max(...rows.map((cells) => cells.length));
+    const line = (cells) => {
+      while (cells.length < width) cells.push("");
+      return "| " + cells.join(" | ") + " |\n";
+    };
+    let markdown = "\n\n" + line(rows[0]);
+    markdown += line(new Array(width).fill("---"));
+    rows.slice(1).forEach((cells) => (markdown += line(cells)));
+    return markdown + "\n";
+  }
+
+  _isSkipped(element) {
+    if (SKIPPED_TAGS.includes(element.nodeName.toUpperCase())) {
+      return true;
+    }
+    if (
+      element.getAttribute("hidden") !== null ||
+      element.getAttribute("aria-hidden") === "true"
+    ) {
+      return true;
+    }
+    if (typeof window !== "undefined" && window.getComputedStyle) {
+      const styles = window.getComputedStyle(element);
+      return styles.display === "none" || styles.visibility === "hidden";
+    }
+    return false;
+  }
+
+  // Remove the whitespace left over from joining blocks together, leaving the
+  // contents of code blocks untouched.
+  _tidy(markdown) {
+    let is_in_code = false;
+    let tidied = [];
+    markdown.split("\n").forEach((line) => {
+      if (line.trim().startsWith("```")) {
+        is_in_code = !is_in_code;
+      }
+      if (!is_in_code) {
+        line = line.replace(/\s+$/, "");
+        if (line === "" && tidied[tidied.length - 1] === "") {
+          return;
+        }
+      }
+      tidied.push(line);
+    });
+    return tidied.join("\n").trim();
+  }
+}
@@ -0,0 +1,222 @@
+// Class names and IDs that suggest an element is page furniture rather than
+// content
+const UNLIKELY_CANDIDATES =
+  /ad-break|advert|agegate|banner|breadcrumb|combx|comment|community|cookie|disqus|extra|footer|header|menu|modal|nav|newsletter|pager|pagination|popup|promo|related|remark|share|shoutbox|sidebar|skyscraper|social|sponsor|subscribe/i;
+const MAYBE_CANDIDATES = /and|article|body|column|content|main|shadow/i;
+const POSITIVE_NAMES =
+  /article|blog|body|content|entry|hentry|h-entry|main|page|post|story|text/i;
+const NEGATIVE_NAMES =
+  /hidden|^hid$|combx|comment|com-|contact|foot|footnote|masthead|media|meta|outbrain|promo|related|scroll|share|shoutbox|sidebar|skyscraper|sponsor|shopping|tags|tool|widget/i;
+
+// Elements that are never part of an article's content
+const REMOVED_TAGS =
+  "script, style, noscript, template, iframe, object, embed, form, button, " +
+  "input, select, textarea, nav, aside, footer";
+
+// Paragraph-like elements whose text is used to score their ancestors
+const SCORED_TAGS = "p, pre, td, blockquote";
+
+// Below this many characters a page isn't considered to have an article
+const MIN_ARTICLE_LENGTH = 250;
+
+// Reader mode strips a page down to its main article, removing navigation,
+// adverts, sidebars and so on, then limits the width of the remaining text so
+// that it's comfortable to read in a terminal.
+//
+// The article is found with a simplified version of the scoring used by
+// Firefox's own Reader View: paragraphs give points to their parents and
+// grandparents, adjusted by whether class names and IDs look like content or
+// furniture, and by how much of an element's text is links.
+export default class {
+  constructor(config) {
+    this.config = config;
+    this.is_enabled = false;
+    this._original_nodes = [];
+  }
+
+  // Returns whether the page had an article to show
+  enable() {
+    if (this.is_enabled) {
+      return true;
+    }
+    const article = this.findArticle(document.body);
+    if (!article) {
+      return false;
+    }
+    this._original_nodes = Array.from(document.body.childNodes);
+    this._original_nodes.forEach((node) => node.remove());
+    document.body.appendChild(this._buildReaderContainer(article));
+    this.is_enabled = true;
+    return true;
+  }
+
+  disable() {
+    if (!this.is_enabled) {
+      return;
+    }
+    Array.from(document.body.childNodes).forEach((node) => node.remove());
+    this._original_nodes.forEach((node) => document.body.appendChild(node));
+    this._original_nodes = [];
+    this.is_enabled = false;
+  }
+
+  findArticle(root) {
+    let candidates = new Map();
+    root.querySelectorAll(SCORED_TAGS).forEach((paragraph) => {
+      const text = paragraph.textContent.trim();
+      if (text.length < 25 || this._hasUnlikelyAncestor(paragraph, root)) {
+        return;
+      }
+      let score = 1;
+      score += text.split(",").length - 1;
+      score += Math.min(Math.floor(text.length / 100), 3);
+      const parent = paragraph.parentNode;
+      const grandparent = parent ? parent.parentNode : null;
+      this._addScore(candidates, parent, score);
+      this._addScore(candidates, grandparent, score / 2);
+    });
+    let best, best_score;
+    candidates.forEach((score, element) => {
+      score = score * (1 - this._linkDensity(element));
+      if (best === undefined || score > best_score) {
+        best = element;
+        best_score = score;
+      }
+    });
+    if (!best || best.textContent.trim().length < MIN_ARTICLE_LENGTH) {
+      return null;
+    }
+    return best;
+  }
+
+  _addScore(candidates, element, score) {
+    if (!element || element.nodeType !== 1) {
+      return;
+    }
+    if (!candidates.has(element)) {
+      candidates.set(element, this._initialScore(element));
+    }
+    candidates.set(element, candidates.get(element) + score);
+  }
+
+  _initialScore(element) {
+    let score = this._classWeight(element);
+    switch (element.nodeName.toUpperCase()) {
+      case "ARTICLE":
+        score += 10;
+        break;
+      case "DIV":
+      case "MAIN":
+      case "SECTION":
+        score += 5;
+        break;
+      case "PRE":
+      case "TD":
+      case "BLOCKQUOTE":
+        score += 3;
+        break;
+      case "OL":
+      case "UL":
+      case "DL":
+      case "FORM":
+        score -= 3;
+        break;
+    }
+    return score;
+  }
+
+  _classWeight(element) {
+    let weight = 0;
+    [element.getAttribute("class"), element.getAttribute("id")].forEach(
+      (name) => {
+        if (!name) {
+          return;
+        }
+        if (NEGATIVE_NAMES.test(name)) {
+          weight -= 25;
+        }
+        if (POSITIVE_NAMES.test(name)) {
+          weight += 25;
+        }
+      }
+    );
+    return weight;
+  }
+
+  _isUnlikelyCandidate(element) {
+    const names =
+      (element.getAttribute("class") || "") +
+      " " +
+      (element.getAttribute("id") || "");
+    return (
+      UNLIKELY_CANDIDATES.test(names) &&
+      !MAYBE_CANDIDATES.test(names) &&
+      element.nodeName.toUpperCase() !== "BODY"
+    );
+  }
+
+  _hasUnlikelyAncestor(element, root) {
+    let node = element.parentNode;
+    while (node && node !== root) {
+      if (node.nodeType === 1 && this._isUnlikelyCandidate(node)) {
+        return true;
+      }
+      node = node.parentNode;
+    }
+    return false;
+  }
+
+  // The proportion of an element's text that is inside links
+  _linkDensity(element) {
+    const length = element.textContent.trim().length;
+    if (length === 0) {
+      return 0;
+    }
+    let link_length = 0;
+    element.querySelectorAll("a").forEach((link) => {
+      link_length += link.textContent.trim().length;
+    });
+    return link_length / length;
+  }
+
+  _buildReaderContainer(article) {
+    let container = document.createElement("div");
+    container.id = "browsh-reader";
+    container.style.setProperty(
+      "max-width",
+      `${this.config.browsh.reader_width}ch`,
+      "important"
+    );
+    container.style.setProperty("margin", "0 auto", "important");
+    container.style.setProperty("padding", "0 1ch", "important");
+    const content = this._clean(article.cloneNode(true));
+    if (document.title && !content.querySelector("h1")) {
+      let title = document.createElement("h1");
+      title.textContent = document.title;
+      container.appendChild(title);
+    }
+    container.appendChild(content);
+    return container;
+  }
+
+  // Remove anything left inside the article that isn't part of its content
+  _clean(article) {
+    article.querySelectorAll(REMOVED_TAGS).forEach((node) => node.remove());
+    article.querySelectorAll("*").forEach((element) => {
+      if (this._isUnlikelyCandidate(element)) {
+        element.remove();
+        return;
+      }
+      // Lists of links, like tags and "read more" sections
+      const tag = element.nodeName.toUpperCase();
+      if (
+        (tag === "UL" || tag === "OL" || tag === "DIV") &&
+        this._linkDensity(element) > 0.5 &&
+        element.textContent.trim().length < 200
+      ) {
+        element.remove();
+      }
+    });
+    return article;
+  }
+}
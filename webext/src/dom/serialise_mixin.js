@@ -1,5 +1,8 @@
 import utils from "utils";
 
+import MarkdownBuilder from "dom/markdown_builder";
+import { encodeTextFrame } from "dom/binary_frame";
+
 export default (MixinBase) =>
   class extends MixinBase {
     __serialiseFrame() {
@@ -31,6 +34,7 @@ export default (MixinBase) =>
       let raw_text = "";
       this._previous_cell_href = "";
       this._is_inside_anchor = false;
+      this._link_footnotes = [];
       const top = this.dimensions.frame.sub.top / 2;
       const left = this.dimensions.frame.sub.left;
       const bottom = top + this.dimensions.frame.sub.height / 2;
@@ -39,8 +43,14 @@ export default (MixinBase) =>
         for (let x = left; x < right; x++) {
           raw_text += this._addCell(x, y, right);
         }
+        if (this._isLinkFootnotesOn()) {
+          raw_text += this._endLinkFootnote();
+        }
         raw_text += "\n";
       }
+      if (this._isLinkFootnotesOn()) {
+        raw_text += this._getLinkFootnotesList();
+      }
       return this._wrap(raw_text);
     }
 
@@ -292,23 +302,69 @@ export default (MixinBase) =>
           "<html>" +
           document.getElementsByTagName("html")[0].innerHTML +
           "</html>";
+      } else if (this._raw_mode_type == "raw_text_markdown") {
+        body = this._wrap(new MarkdownBuilder().build(document.body));
+      } else if (this._raw_mode_type == "raw_text_links") {
+        // The links are already part of every payload
+        this._markParsingDuration();
+        body = "";
       } else {
         body = this._serialiseRawText();
       }
       let payload = {
         body: body,
+        title: document.title,
+        url: document.location.href,
+        links: this._getRawTextLinks(),
         page_load_duration: this.config.page_load_duration,
         parsing_duration: this._parsing_duration,
       };
-      this.sendMessage(`/raw_text,${JSON.stringify(payload)}`);
+      this.sendMessage("/raw_text", payload);
+    }
+
+    // Note that `href` on an anchor element is always the absolute URL
+    _getRawTextLinks() {
+      let links = [];
+      document.querySelectorAll("a[href]").forEach((anchor) => {
+        if (anchor.href.startsWith("javascript:")) {
+          return;
+        }
+        links.push({
+          text: anchor.textContent.trim(),
+          href: anchor.href,
+          position: this._getLinkPosition(anchor),
+        });
+      });
+      return links;
+    }
+
+    // Convert the anchor's DOM rectangle to the same character cells used by the
+    // raw text. Anchors that take up no space, like hidden ones, don't have a
+    // position.
+    _getLinkPosition(anchor) {
+      const rect = anchor.getBoundingClientRect();
+      if (rect.width === 0 || rect.height === 0) {
+        return undefined;
+      }
+      const scale = this.dimensions.scale_factor;
+      const top = (rect.top + window.scrollY) * scale.height;
+      const left = (rect.left + window.scrollX) * scale.width;
+      return {
+        column: utils.snap(left) - this.dimensions.frame.sub.left,
+        row: utils.snap(top / 2) - this.dimensions.frame.sub.top / 2,
+        width: Math.max(1, utils.snap(rect.width * scale.width)),
+        height: Math.max(1, utils.snap((rect.height * scale.height) / 2)),
+      };
     }
 
     _sendFrame() {
       this._serialiseFrame();
-      if (this.frame.text.length > 0) {
-        this.sendMessage(`/frame_text,${JSON.stringify(this.frame)}`);
-      } else {
+      if (this.frame.text.length === 0) {
         this.log("Not sending empty text frame");
+      } else if (this.config.binary_frames) {
+        this.sendBinaryMessage(encodeTextFrame(this.frame));
+      } else {
+        this.sendMessage("/frame_text", this.frame);
       }
     }
 
@@ -388,10 +444,66 @@ export default (MixinBase) =>
     }
 
     _addCellAsPlainText() {
+      let text = "";
+      if (this._isLinkFootnotesOn()) {
+        text += this._trackLinkFootnote();
+      }
       if (this._cell_for_raw_text === undefined) {
-        return " ";
+        return text + " ";
       }
-      return this._cell_for_raw_text.rune;
+      return text + this._cell_for_raw_text.rune;
+    }
+
+    // Lynx-style link references. Links in PLAIN mode are followed by a number,
+    // like "Browsh[1]", which refers to the list of URLs at the end of the page.
+    _isLinkFootnotesOn() {
+      return (
+        this._raw_mode_type !== "raw_text_html" &&
+        this.config["http-server"].link_footnotes === true
+      );
+    }
+
+    // Anchors can't be nested, so a link ends whenever a cell has a different
+    // href from the previous cell.
+    _trackLinkFootnote() {
+      let href;
+      if (this._cell_for_raw_text) {
+        href = this._cell_for_raw_text.parent_element.href;
+      }
+      if (typeof href !== "string" || href.startsWith("javascript:")) {
+        href = "";
+      }
+      if (href === this._previous_cell_href) {
+        return "";
+      }
+      const marker = this._endLinkFootnote();
+      this._previous_cell_href = href;
+      return marker;
+    }
+
+    // The same URL always gets the same number
+    _endLinkFootnote() {
+      const href = this._previous_cell_href;
+      this._previous_cell_href = "";
+      if (!href) {
+        return "";
+      }
+      let number = this._link_footnotes.indexOf(href) + 1;
+      if (number === 0) {
+        number = this._link_footnotes.push(href);
+      }
+      return `[${number}]`;
+    }
+
+    _getLinkFootnotesList() {
+      if (this._link_footnotes.length === 0) {
+        return "";
+      }
+      let list = "\nReferences\n\n";
+      this._link_footnotes.forEach((href, index) => {
+        list += `${(index + 1).toString().padStart(4)}. ${href}\n`;
+      });
+      return list;
     }
 
     _setupFrameMeta() {
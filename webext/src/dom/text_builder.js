@@ -30,7 +30,12 @@ export default class extends utils.mixins(CommonMixin, SerialiseMixin) {
   sendRawText(type) {
     this._raw_mode_type = type;
     this._parse_start_time = performance.now();
-    if (type == "raw_text_dom") {
+    // These modes work directly from the DOM, so they don't need the TTY grid
+    if (
+      type == "raw_text_dom" ||
+      type == "raw_text_markdown" ||
+      type == "raw_text_links"
+    ) {
       setTimeout(() => {
         this._sendRawText();
       }, this.config["http-server"].render_delay);
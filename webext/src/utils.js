@@ -31,10 +31,6 @@ export default {
     return number;
   },
 
-  rebuildArgsToSingleArg: function (args) {
-    return args.slice(1).join(",");
-  },
-
   uuidv4: function () {
     return "xxxxxxxx-xxxx-4xxx-yxxx-xxxxxxxxxxxx".replace(
       /[xy]/g,
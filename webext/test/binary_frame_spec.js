@@ -0,0 +1,58 @@
+import { expect } from "chai";
+
+import {
+  encodeColours,
+  encodePixelsFrame,
+  encodeTextFrame,
+} from "dom/binary_frame";
+
+const meta = {
+  id: 1,
+  sub_width: 2,
+  sub_height: 2,
+  sub_left: 0,
+  sub_top: 4,
+  total_width: 2,
+  total_height: 8,
+};
+
+describe("Binary frames", () => {
+  it("should run-length encode blocks of the same colour", () => {
+    const colours = encodeColours([1, 2, 3, 1, 2, 3, 1, 2, 3, 4, 5, 6]);
+    expect(colours.encoding).to.equal(1);
+    expect(Array.from(colours.data)).to.deep.equal([3, 1, 2, 3, 1, 4, 5, 6]);
+  });
+
+  it("should pack colours when runs wouldn't be any smaller", () => {
+    const colours = encodeColours([1, 2, 3, 4, 5, 6]);
+    expect(colours.encoding).to.equal(0);
+    expect(Array.from(colours.data)).to.deep.equal([1, 2, 3, 4, 5, 6]);
+  });
+
+  it("should start with the kind of frame and its meta", () => {
+    const view = new DataView(
+      encodePixelsFrame({ meta: meta, colours: new Array(12).fill(0) }),
+    );
+    expect(view.getUint8(0)).to.equal(2);
+    expect(view.getUint8(1)).to.equal(1);
+    expect(view.getInt32(2, true)).to.equal(1);
+    expect(view.getInt32(18, true)).to.equal(4);
+    expect(view.getInt32(26, true)).to.equal(8);
+  });
+
+  it("should prefix each cell's text with its length", () => {
+    const buffer = encodeTextFrame({
+      meta: meta,
+      colours: [0, 0, 0, 0, 0, 0],
+      text: ["é", ""],
+      input_boxes: {},
+    });
+    const bytes = new Uint8Array(buffer);
+    // The header, then one run of colours
+    const text = 30 + 5 + 4;
+    expect(Array.from(bytes.slice(text, text + 8))).to.deep.equal([
+      4, 0, 0, 0, 2, 0xc3, 0xa9, 0,
+    ]);
+    expect(new TextDecoder().decode(bytes.slice(text + 12))).to.equal("{}");
+  });
+});
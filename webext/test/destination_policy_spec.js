@@ -0,0 +1,125 @@
+import { expect } from "chai";
+
+import DestinationPolicy, {
+  isAllowedDomain,
+  parseIP,
+} from "background/destination_policy";
+
+describe("Destination policy", () => {
+  let policy;
+
+  beforeEach(() => {
+    policy = new DestinationPolicy({
+      "blocked-destination-ranges": [
+        "10.0.0.0/8",
+        "127.0.0.0/8",
+        "169.254.0.0/16",
+        "::1/128",
+        "fc00::/7",
+      ],
+      "allowed-destinations": ["intranet.example.com", "10.1.0.0/16"],
+    });
+    global.browser = {
+      dns: {
+        resolve: (host) => {
+          const records = {
+            "metadata.internal": ["169.254.169.254"],
+            "www.brow.sh": ["104.21.0.1", "2606:4700::1"],
+            "sneaky.example.com": ["104.21.0.1", "::1"],
+          };
+          if (!records[host]) {
+            return Promise.reject(new Error("NS_ERROR_UNKNOWN_HOST"));
+          }
+          return Promise.resolve({ addresses: records[host] });
+        },
+      },
+    };
+  });
+
+  afterEach(() => {
+    delete global.browser;
+  });
+
+  describe("Parsing IPs", () => {
+    it("should map IPv4 addresses into IPv6", () => {
+      expect(parseIP("127.0.0.1")).to.deep.equal(parseIP("::ffff:7f00:1"));
+      expect(parseIP("::ffff:127.0.0.1")).to.deep.equal(parseIP("127.0.0.1"));
+    });
+
+    it("should expand compressed IPv6 addresses", () => {
+      expect(parseIP("fe80::1%eth0")).to.deep.equal([
+        0xfe, 0x80, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 1,
+      ]);
+    });
+
+    it("should not parse host names", () => {
+      expect(parseIP("www.brow.sh")).to.equal(null);
+      expect(parseIP("1.2.3.4.5")).to.equal(null);
+      expect(parseIP("1::2::3")).to.equal(null);
+    });
+  });
+
+  describe("Private addresses", () => {
+    it("should find addresses in the blocked ranges", () => {
+      expect(policy.isPrivate("169.254.169.254")).to.equal(true);
+      expect(policy.isPrivate("::ffff:10.0.0.1")).to.equal(true);
+      expect(policy.isPrivate("fd00:ec2::254")).to.equal(true);
+      expect(policy.isPrivate("8.8.8.8")).to.equal(false);
+    });
+
+    it("should let the allowed ranges through", () => {
+      expect(policy.isPrivate("10.1.2.3")).to.equal(false);
+    });
+  });
+
+  describe("URLs", () => {
+    const expectAllowed = (url, expected) =>
+      policy.isAllowed(url).then((is_allowed) => {
+        expect(is_allowed).to.equal(expected);
+      });
+
+    it("should block private IP addresses", () => {
+      return Promise.all([
+        expectAllowed("http://127.0.0.1:4444/", false),
+        expectAllowed("http://[::1]/", false),
+        expectAllowed("http://10.1.0.1/", true),
+      ]);
+    });
+
+    it("should block hosts that resolve to private addresses", () => {
+      return Promise.all([
+        expectAllowed("http://metadata.internal/computeMetadata/", false),
+        expectAllowed("https://sneaky.example.com/", false),
+        expectAllowed("https://www.brow.sh/", true),
+      ]);
+    });
+
+    it("should block hosts that don't resolve", () => {
+      return expectAllowed("http://nowhere.invalid/", false);
+    });
+
+    it("should allow hosts in the allow list without resolving them", () => {
+      return expectAllowed("http://intranet.example.com/", true);
+    });
+  });
+
+  describe("API key domains", () => {
+    const domains = ["example.com"];
+
+    it("should allow the domain and its subdomains", () => {
+      expect(isAllowedDomain("https://example.com/page", domains)).to.be.true;
+      expect(isAllowedDomain("https://www.example.com/", domains)).to.be.true;
+    });
+
+    it("should not allow other domains", () => {
+      expect(isAllowedDomain("https://notexample.com/", domains)).to.be.false;
+      expect(isAllowedDomain("https://example.com.evil.com/", domains)).to.be
+        .false;
+    });
+
+    it("should allow anywhere for keys without domains", () => {
+      expect(isAllowedDomain("https://anywhere.com/", [])).to.be.true;
+      expect(isAllowedDomain("https://anywhere.com/", undefined)).to.be.true;
+    });
+  });
+});
@@ -0,0 +1,68 @@
+import { expect } from "chai";
+
+import SerialiseMixin from "dom/serialise_mixin";
+
+const Serialiser = SerialiseMixin(class {});
+
+function cell(rune, href) {
+  return { rune: rune, parent_element: { href: href } };
+}
+
+describe("Link footnotes", () => {
+  let serialiser;
+
+  function serialise(cells) {
+    let text = "";
+    cells.forEach((c) => {
+      serialiser._cell_for_raw_text = c;
+      text += serialiser._addCellAsPlainText();
+    });
+    return text + serialiser._endLinkFootnote();
+  }
+
+  beforeEach(() => {
+    serialiser = new Serialiser();
+    serialiser.config = { "http-server": { link_footnotes: true } };
+    serialiser._raw_mode_type = "raw_text_plain";
+    serialiser._previous_cell_href = "";
+    serialiser._link_footnotes = [];
+  });
+
+  it("should number each link after its text", () => {
+    const text = serialise([
+      cell("a", "https://a.com/"),
+      cell(" ", undefined),
+      cell("b", "https://b.com/"),
+      cell("c", "https://b.com/"),
+    ]);
+    expect(text).to.equal("a[1] bc[2]");
+  });
+
+  it("should give the same URL the same number", () => {
+    const text = serialise([
+      cell("a", "https://a.com/"),
+      undefined,
+      cell("b", "https://a.com/"),
+    ]);
+    expect(text).to.equal("a[1] b[1]");
+    expect(serialiser._link_footnotes).to.deep.equal(["https://a.com/"]);
+  });
+
+  it("should ignore javascript links", () => {
+    const text = serialise([cell("a", "javascript:void(0)")]);
+    expect(text).to.equal("a");
+  });
+
+  it("should list the URLs", () => {
+    serialise([cell("a", "https://a.com/"), cell("b", "https://b.com/")]);
+    expect(serialiser._getLinkFootnotesList()).to.equal(
+      "\nReferences\n\n   1. https://a.com/\n   2. https://b.com/\n"
+    );
+  });
+
+  it("should do nothing when turned off", () => {
+    serialiser.config["http-server"].link_footnotes = false;
+    const text = serialise([cell("a", "https://a.com/")]);
+    expect(text).to.equal("a");
+  });
+});
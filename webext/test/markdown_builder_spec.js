@@ -0,0 +1,71 @@
+import { expect } from "chai";
+
+import MarkdownBuilder from "dom/markdown_builder";
+import { element as el } from "mocks/element";
+
+function build(...children) {
+  return new MarkdownBuilder().build(el("body", {}, ...children));
+}
+
+describe("Markdown Builder", () => {
+  it("should convert headings and inline formatting", () => {
+    const markdown = build(
+      el("h2", {}, " Hello ", el("em", {}, "world")),
+      el("p", {}, "Some ", el("strong", {}, "bold"), " text")
+    );
+    expect(markdown).to.equal("## Hello *world*\n\nSome **bold** text\n");
+  });
+
+  it("should convert links and images", () => {
+    const markdown = build(
+      el("p", {}, el("a", { href: "https://www.brow.sh/" }, "Browsh")),
+      el("img", { src: "https://www.brow.sh/logo.png", alt: "Logo" })
+    );
+    expect(markdown).to.equal(
+      "[Browsh](https://www.brow.sh/)\n\n![Logo](https://www.brow.sh/logo.png)\n"
+    );
+  });
+
+  it("should convert nested lists", () => {
+    const markdown = build(
+      el(
+        "ul",
+        {},
+        el("li", {}, "one"),
+        el("li", {}, "two", el("ol", {}, el("li", {}, "a"), el("li", {}, "b")))
+      )
+    );
+    expect(markdown).to.equal("- one\n- two\n\n  1. a\n  2. b\n");
+  });
+
+  it("should keep code blocks verbatim", () => {
+    const code = "if (x) {\n\n\n    y();\n}\n";
+    const markdown = build(
+      el("pre", {}, el("code", { class: "language-js" }, code))
+    );
+    expect(markdown).to.equal("```js\nif (x) {\n\n\n    y();\n}\n```\n");
+  });
+
+  it("should convert tables", () => {
+    const markdown = build(
+      el(
+        "table",
+        {},
+        el("tr", {}, el("th", {}, "Name"), el("th", {}, "a|b")),
+        el("tr", {}, el("td", {}, "1"), el("td", {}, "2"))
+      )
+    );
+    expect(markdown).to.equal(
+      "| Name | a\\|b |\n| --- | --- |\n| 1 | 2 |\n"
+    );
+  });
+
+  it("should skip scripts and hidden elements", () => {
+    const markdown = build(
+      el("script", {}, "alert(1)"),
+      el("div", { hidden: "" }, "secret"),
+      el("p", {}, "visible")
+    );
+    expect(markdown).to.equal("visible\n");
+  });
+});
@@ -0,0 +1,42 @@
+// Just enough of the DOM's Node interface to build small documents in tests
+export function text(content) {
+  return {
+    nodeType: 3,
+    nodeName: "#text",
+    textContent: content,
+  };
+}
+
+export function element(tag, attributes = {}, ...children) {
+  let node = {
+    nodeType: 1,
+    nodeName: tag.toUpperCase(),
+    parentNode: null,
+    href: attributes.href,
+    src: attributes.src,
+    childNodes: children.map((c) => (typeof c === "string" ? text(c) : c)),
+    getAttribute: (name) => (name in attributes ? attributes[name] : null),
+    get textContent() {
+      return this.childNodes.map((c) => c.textContent).join("");
+    },
+    querySelector(selector) {
+      return this.querySelectorAll(selector)[0] || null;
+    },
+    // Only supports selectors that are lists of tag names, eg; "p, pre"
+    querySelectorAll(selector) {
+      const tags = selector.split(",").map((t) => t.trim().toUpperCase());
+      let found = [];
+      const walk = (node) => {
+        node.childNodes.forEach((child) => {
+          if (child.nodeType !== 1) return;
+          if (tags.includes(child.nodeName)) found.push(child);
+          walk(child);
+        });
+      };
+      walk(this);
+      return found;
+    },
+  };
+  node.childNodes.forEach((child) => (child.parentNode = node));
+  return node;
+}
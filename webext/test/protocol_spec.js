@@ -0,0 +1,34 @@
+import { expect } from "chai";
+
+import {
+  commandOf,
+  encode,
+  decode,
+  PROTOCOL_VERSION,
+} from "background/protocol";
+
+describe("Protocol", () => {
+  it("should keep commas in payloads", () => {
+    const url = "https://www.brow.sh/?a=1,2,3";
+    const envelope = decode(encode("/new_tab", { url: url }));
+    expect(envelope.version).to.equal(PROTOCOL_VERSION);
+    expect(envelope.command).to.equal("/new_tab");
+    expect(envelope.payload.url).to.equal(url);
+  });
+
+  it("should add a tab ID and correlation ID", () => {
+    const envelope = decode(
+      encode("/raw_text_blocked", undefined, { correlation_id: "abc" }),
+    );
+    expect(envelope.correlation_id).to.equal("abc");
+    expect(envelope.payload).to.deep.equal({});
+  });
+
+  it("should find the command without parsing the payload", () => {
+    const frame = { meta: { id: 1 }, text: ["a,b"] };
+    expect(commandOf(encode("/frame_text", frame, { tab_id: 1 }))).to.equal(
+      "/frame_text",
+    );
+    expect(commandOf("/frame_text,{}")).to.be.undefined;
+  });
+});
@@ -0,0 +1,62 @@
+import { expect } from "chai";
+
+import Reader from "dom/reader";
+import { element as el } from "mocks/element";
+
+const sentence =
+  "Browsh is a fully-modern text-based browser, it renders anything that a " +
+  "modern browser can, including HTML5, CSS3, JS, video and even WebGL. ";
+
+function paragraph() {
+  return el("p", {}, sentence);
+}
+
+describe("Reader", () => {
+  let reader;
+
+  beforeEach(() => {
+    reader = new Reader({ browsh: { reader_width: 72 } });
+  });
+
+  it("should find the element containing the most paragraphs", () => {
+    const article = el("div", { class: "post" }, paragraph(), paragraph());
+    const body = el(
+      "body",
+      {},
+      el("div", { class: "menu" }, el("a", { href: "/" }, "Home")),
+      article
+    );
+    expect(reader.findArticle(body)).to.equal(article);
+  });
+
+  it("should ignore paragraphs inside page furniture", () => {
+    const article = el("div", {}, paragraph(), paragraph());
+    const sidebar = el(
+      "div",
+      { id: "sidebar" },
+      paragraph(),
+      paragraph(),
+      paragraph()
+    );
+    const body = el("body", {}, sidebar, article);
+    expect(reader.findArticle(body)).to.equal(article);
+  });
+
+  it("should prefer content over lists of links", () => {
+    const article = el("div", {}, paragraph(), paragraph());
+    const links = el(
+      "div",
+      {},
+      el("p", {}, el("a", { href: "/1" }, sentence)),
+      el("p", {}, el("a", { href: "/2" }, sentence)),
+      el("p", {}, el("a", { href: "/3" }, sentence))
+    );
+    const body = el("body", {}, links, article);
+    expect(reader.findArticle(body)).to.equal(article);
+  });
+
+  it("should not find an article on pages without much text", () => {
+    const body = el("body", {}, el("div", {}, paragraph()));
+    expect(reader.findArticle(body)).to.equal(null);
+  });
+});